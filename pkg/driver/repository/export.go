@@ -0,0 +1,442 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ExportSelection identifies a set of records to export.
+type ExportSelection struct {
+	Model interface{}   // Pointer to a model struct, e.g. &MyDatum{}.
+	Query interface{}   // Optional; when nil all live records of Model are selected.
+	Args  []interface{} // Arguments for Query.
+}
+
+// ExportRecord is the structure of each line produced by Export.
+type ExportRecord struct {
+	Table  string          `json:"table"`
+	Join   bool            `json:"join,omitempty"` // True for many2many join-table rows.
+	Record json.RawMessage `json:"record"`         // Column name => value.
+}
+
+// Export writes the records matched by selections to w in JSON Lines format,
+// one ExportRecord per line.
+//
+// Associations (belongs_to, has_one, has_many and many2many) are followed
+// transitively so that related records are included as well.  Records are
+// ordered such that belongs_to targets precede the records referencing them,
+// and many2many join rows follow both of their endpoints.  Each record is
+// written at most once.
+//
+// Under postgres all reads take place in a single REPEATABLE READ transaction
+// to provide a consistent snapshot.
+//
+// NB: Fields tagged with `encrypt:"true"' are exported in plaintext.
+func (driver *GormRepositoryDriver) Export(w io.Writer, selections ...ExportSelection) (count int64, err error) {
+	err = driver.inTransaction(func(tx *gorm.DB) error {
+		if tx.Dialect().GetName() == "postgres" {
+			if err := tx.Exec("SET TRANSACTION ISOLATION LEVEL REPEATABLE READ READ ONLY").Error; err != nil {
+				return err
+			}
+		}
+		e := &exporter{
+			tx:      tx,
+			encoder: json.NewEncoder(w),
+			seen:    map[string]struct{}{},
+		}
+		for _, selection := range selections {
+			if err := e.exportSelection(selection); err != nil {
+				return err
+			}
+		}
+		count = e.count
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("gorm driver: exp- %s", err)
+		return
+	}
+	return
+}
+
+// Import reads records produced by Export from r and writes them to the
+// database in a single transaction, returning the number of records read.
+//
+// Every table referenced by the input must correspond to one of models (except
+// for many2many join tables).  Importing is idempotent: records which already
+// exist (by primary key) are updated in place, and join rows are only inserted
+// when absent.  Records are written as-is without validation, and timestamps
+// are preserved.
+//
+// Under postgres the sequences for imported tables are advanced past the
+// largest imported id so subsequent inserts don't collide.
+func (driver *GormRepositoryDriver) Import(r io.Reader, models ...interface{}) (count int64, err error) {
+	err = driver.inTransaction(func(tx *gorm.DB) error {
+		types := map[string]reflect.Type{}
+		for _, model := range models {
+			t := reflect.TypeOf(model)
+			for t.Kind() == reflect.Ptr {
+				t = t.Elem()
+			}
+			types[tx.NewScope(model).TableName()] = t
+		}
+
+		imported := map[string]*gorm.Scope{}
+		decoder := json.NewDecoder(r)
+		decoder.UseNumber()
+		for {
+			var record ExportRecord
+			if err := decoder.Decode(&record); err == io.EOF {
+				break
+			} else if err != nil {
+				return fmt.Errorf("record #%v: %s", count+1, err)
+			}
+			count++
+
+			if record.Join {
+				row := map[string]interface{}{}
+				if err := unmarshalRecord(record.Record, &row); err != nil {
+					return fmt.Errorf("record #%v: %s", count, err)
+				}
+				if err := insertIfAbsent(tx, record.Table, row); err != nil {
+					return fmt.Errorf("record #%v: %s", count, err)
+				}
+				continue
+			}
+
+			t, ok := types[record.Table]
+			if !ok {
+				return fmt.Errorf("record #%v: no model provided for table=%v", count, record.Table)
+			}
+			scope, err := importRecord(tx, t, record.Record)
+			if err != nil {
+				return fmt.Errorf("record #%v: %s", count, err)
+			}
+			imported[record.Table] = scope
+		}
+
+		if tx.Dialect().GetName() == "postgres" {
+			for _, scope := range imported {
+				if err := resetSequence(tx, scope); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("gorm driver: imp- %s", err)
+		return
+	}
+	return
+}
+
+type exporter struct {
+	tx      *gorm.DB
+	encoder *json.Encoder
+	seen    map[string]struct{}
+	count   int64
+}
+
+func (e *exporter) exportSelection(selection ExportSelection) error {
+	t := reflect.TypeOf(selection.Model)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return fmt.Errorf("invalid selection model type=%v, must be a struct", t)
+	}
+	results := reflect.New(reflect.SliceOf(t))
+
+	db := e.tx
+	if selection.Query != nil {
+		db = db.Where(selection.Query, selection.Args...)
+	}
+	if primaryField := e.tx.NewScope(selection.Model).PrimaryField(); primaryField != nil {
+		db = db.Order(e.tx.NewScope(selection.Model).Quote(primaryField.DBName))
+	}
+	if err := db.Find(results.Interface()).Error; err != nil {
+		return err
+	}
+	for i := 0; i < results.Elem().Len(); i++ {
+		if err := e.exportRecord(results.Elem().Index(i).Addr().Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportRecord writes record along with everything it's associated with.
+func (e *exporter) exportRecord(record interface{}) error {
+	scope := e.tx.NewScope(record)
+	columns := recordColumns(scope)
+	key, err := recordKey(scope, columns)
+	if err != nil {
+		return err
+	}
+	if _, ok := e.seen[key]; ok {
+		return nil
+	}
+	e.seen[key] = struct{}{}
+
+	fields := scope.Fields()
+	for _, field := range fields {
+		if field.Relationship == nil || field.Relationship.Kind != "belongs_to" {
+			continue
+		}
+		if _, err := e.exportRelated(record, field); err != nil {
+			return err
+		}
+	}
+
+	if err := e.write(scope.TableName(), false, columns); err != nil {
+		return err
+	}
+
+	for _, field := range fields {
+		if field.Relationship == nil || field.Relationship.Kind == "belongs_to" {
+			continue
+		}
+		related, err := e.exportRelated(record, field)
+		if err != nil {
+			return err
+		}
+		if field.Relationship.Kind != "many_to_many" {
+			continue
+		}
+		handler := field.Relationship.JoinTableHandler
+		for _, item := range related {
+			row := map[string]interface{}{}
+			for _, foreignKey := range handler.SourceForeignKeys() {
+				if source, ok := scope.FieldByName(foreignKey.AssociationDBName); ok {
+					row[foreignKey.DBName] = source.Field.Interface()
+				}
+			}
+			for _, foreignKey := range handler.DestinationForeignKeys() {
+				if destination, ok := e.tx.NewScope(item).FieldByName(foreignKey.AssociationDBName); ok {
+					row[foreignKey.DBName] = destination.Field.Interface()
+				}
+			}
+			table := handler.Table(e.tx)
+			joinKey, err := recordKey(nil, row)
+			if err != nil {
+				return err
+			}
+			if _, ok := e.seen[table+joinKey]; ok {
+				continue
+			}
+			e.seen[table+joinKey] = struct{}{}
+			if err := e.write(table, true, row); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// exportRelated loads and exports the records associated with record via field,
+// returning pointers to them.
+func (e *exporter) exportRelated(record interface{}, field *gorm.Field) (related []interface{}, err error) {
+	t := field.Struct.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	value := reflect.New(t)
+	err = e.tx.Model(record).Association(field.Name).Find(value.Interface()).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("loading %v: %s", field.Name, err)
+	}
+
+	if value.Elem().Kind() == reflect.Slice {
+		for i := 0; i < value.Elem().Len(); i++ {
+			item := value.Elem().Index(i)
+			if item.Kind() != reflect.Ptr {
+				item = item.Addr()
+			}
+			related = append(related, item.Interface())
+		}
+	} else if !e.tx.NewScope(value.Interface()).PrimaryKeyZero() {
+		related = append(related, value.Interface())
+	}
+
+	for _, item := range related {
+		if err = e.exportRecord(item); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (e *exporter) write(table string, join bool, columns map[string]interface{}) error {
+	data, err := json.Marshal(columns)
+	if err != nil {
+		return fmt.Errorf("encoding %v record: %s", table, err)
+	}
+	record := ExportRecord{
+		Table:  table,
+		Join:   join,
+		Record: json.RawMessage(data),
+	}
+	if err := e.encoder.Encode(&record); err != nil {
+		return err
+	}
+	e.count++
+	return nil
+}
+
+// recordColumns returns the column values for the regular (non-association)
+// fields of the scope value.
+func recordColumns(scope *gorm.Scope) map[string]interface{} {
+	columns := map[string]interface{}{}
+	for _, field := range scope.Fields() {
+		if field.IsNormal && !field.IsIgnored {
+			columns[field.DBName] = field.Field.Interface()
+		}
+	}
+	return columns
+}
+
+// recordKey produces a string uniquely identifying a record, based on the
+// primary key when available and otherwise on all of its columns.
+func recordKey(scope *gorm.Scope, columns map[string]interface{}) (string, error) {
+	if scope != nil && scope.PrimaryField() != nil {
+		return fmt.Sprintf("%v:%v", scope.TableName(), scope.PrimaryKeyValue()), nil
+	}
+	// NB: encoding/json sorts map keys, so the output is stable.
+	data, err := json.Marshal(columns)
+	if err != nil {
+		return "", err
+	}
+	if scope != nil {
+		return scope.TableName() + string(data), nil
+	}
+	return string(data), nil
+}
+
+// importRecord decodes data into a new instance of t and upserts it.
+func importRecord(tx *gorm.DB, t reflect.Type, data json.RawMessage) (*gorm.Scope, error) {
+	columns := map[string]json.RawMessage{}
+	if err := unmarshalRecord(data, &columns); err != nil {
+		return nil, err
+	}
+	value := reflect.New(t).Interface()
+	scope := tx.NewScope(value)
+	for _, field := range scope.Fields() {
+		if !field.IsNormal || field.IsIgnored {
+			continue
+		}
+		raw, ok := columns[field.DBName]
+		if !ok {
+			continue
+		}
+		if err := json.Unmarshal(raw, field.Field.Addr().Interface()); err != nil {
+			return nil, fmt.Errorf("decoding %v.%v: %s", scope.TableName(), field.DBName, err)
+		}
+	}
+
+	if scope.PrimaryField() == nil || scope.PrimaryKeyZero() {
+		// Without a primary key the only identity is the full set of columns.
+		return scope, insertIfAbsent(tx, scope.TableName(), recordColumns(scope))
+	}
+
+	var existing int64
+	primaryField := scope.PrimaryField()
+	condition := fmt.Sprintf("%v = ?", scope.Quote(primaryField.DBName))
+	if err := tx.Unscoped().Table(scope.TableName()).Where(condition, primaryField.Field.Interface()).Count(&existing).Error; err != nil {
+		return nil, err
+	}
+	// Prevent timestamps from being touched and associations from being saved.
+	tx = tx.Set("gorm:update_column", true).Set("gorm:save_associations", false)
+	if existing > 0 {
+		if err := tx.Save(value).Error; err != nil {
+			return nil, err
+		}
+	} else {
+		if err := tx.Create(value).Error; err != nil {
+			return nil, err
+		}
+	}
+	return scope, nil
+}
+
+// insertIfAbsent inserts row into table unless an identical row exists.
+func insertIfAbsent(tx *gorm.DB, table string, row map[string]interface{}) error {
+	if len(row) == 0 {
+		return errors.New("empty record")
+	}
+	var (
+		scope        = tx.NewScope(nil)
+		names        = make([]string, 0, len(row))
+		quoted       = make([]string, 0, len(row))
+		placeholders = make([]string, 0, len(row))
+		args         = make([]interface{}, 0, len(row))
+		query        = tx.Unscoped().Table(table)
+		existing     int64
+	)
+	for name := range row {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		quoted = append(quoted, scope.Quote(name))
+		placeholders = append(placeholders, "?")
+		args = append(args, row[name])
+		query = query.Where(fmt.Sprintf("%v = ?", scope.Quote(name)), row[name])
+	}
+	if err := query.Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		return nil
+	}
+	insert := fmt.Sprintf("INSERT INTO %v (%v) VALUES (%v)", scope.Quote(table), strings.Join(quoted, ", "), strings.Join(placeholders, ", "))
+	return tx.Exec(insert, args...).Error
+}
+
+// resetSequence advances the postgres sequence backing the primary key of the
+// scope's table (if any) past the largest id present.  Tables with
+// non-integer primary keys, or without a serial sequence, are left alone.
+func resetSequence(tx *gorm.DB, scope *gorm.Scope) error {
+	primaryField := scope.PrimaryField()
+	if primaryField == nil {
+		return nil
+	}
+	switch primaryField.Struct.Type.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	default:
+		return nil
+	}
+	var sequence sql.NullString
+	if err := tx.Raw(`SELECT pg_get_serial_sequence(?, ?)`, scope.QuotedTableName(), primaryField.DBName).Row().Scan(&sequence); err != nil {
+		return fmt.Errorf("looking up sequence for table=%v: %s", scope.TableName(), err)
+	}
+	if !sequence.Valid {
+		return nil
+	}
+	query := fmt.Sprintf(
+		`SELECT setval(?, (SELECT COALESCE(MAX(%v), 0) + 1 FROM %v), false)`,
+		scope.Quote(primaryField.DBName),
+		scope.QuotedTableName(),
+	)
+	if err := tx.Exec(query, sequence.String).Error; err != nil {
+		return fmt.Errorf("resetting sequence for table=%v: %s", scope.TableName(), err)
+	}
+	return nil
+}
+
+func unmarshalRecord(data json.RawMessage, v interface{}) error {
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
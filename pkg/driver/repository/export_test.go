@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	driver, cleanupFunc := reset(t, dbDriverName, dbConnectionStrings)
+	defer cleanupFunc()
+
+	tags := []*Tag{{Name: "red"}, {Name: "blue"}, {Name: "unrelated"}}
+	for _, tag := range tags {
+		if err := driver.Save(tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+	myDatum := &MyDatum{Name: "Exported", HomePlanet: "Mars"}
+	if err := driver.Save(myDatum); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.AppendRelated(myDatum, "Tags", tags[0], tags[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	count, err := driver.Export(buf, ExportSelection{Model: &MyDatum{}, Query: "name = ?", Args: []interface{}{"Exported"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1 datum + 2 tags + 2 join rows.
+	if expected, actual := int64(5), count; actual != expected {
+		t.Fatalf("Expected export count=%v but actual=%v; export:\n%s", expected, actual, buf.String())
+	}
+	export := buf.String()
+
+	tables := map[string]int{}
+	scanner := bufio.NewScanner(bytes.NewBufferString(export))
+	for scanner.Scan() {
+		var record ExportRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		tables[record.Table]++
+	}
+	if tables["my_datum"] != 1 || tables["tag"] != 2 || tables["my_datum_tag"] != 2 {
+		t.Errorf("Unexpected export table counts=%v; export:\n%s", tables, export)
+	}
+
+	// Clear everything out and import twice to verify idempotency.
+	if err := driver.Exec(`DELETE FROM "my_datum_tag"`); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Exec(`DELETE FROM "my_datum"`); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Exec(`DELETE FROM "tag"`); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		imported, err := driver.Import(bytes.NewBufferString(export), &MyDatum{}, &Tag{})
+		if err != nil {
+			t.Fatalf("[i=%v] %s", i, err)
+		}
+		if expected, actual := count, imported; actual != expected {
+			t.Errorf("[i=%v] Expected import count=%v but actual=%v", i, expected, actual)
+		}
+	}
+
+	found := &MyDatum{}
+	if err := driver.FirstWhere(found, "name = ?", "Exported"); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := myDatum.Id, found.Id; actual != expected {
+		t.Errorf("Expected imported id=%v but actual=%v", expected, actual)
+	}
+	if expected, actual := myDatum.CreatedAt.Unix(), found.CreatedAt.Unix(); actual != expected {
+		t.Errorf("Expected imported created-at=%v but actual=%v", expected, actual)
+	}
+	if numTags, err := driver.CountRelated(found, "Tags"); err != nil {
+		t.Fatal(err)
+	} else if expected, actual := int64(2), numTags; actual != expected {
+		t.Errorf("Expected imported datum to have %v tags but actual=%v", expected, actual)
+	}
+	if numTags, err := driver.CountWhere(&Tag{}); err != nil {
+		t.Fatal(err)
+	} else if expected, actual := int64(2), numTags; actual != expected {
+		t.Errorf("Expected %v tags after import but actual=%v", expected, actual)
+	}
+
+	// Sequences must have been advanced past the imported ids.
+	if err := driver.Save(&Tag{Name: "after-import"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportUnknownTable(t *testing.T) {
+	driver, cleanupFunc := reset(t, dbDriverName, dbConnectionStrings)
+	defer cleanupFunc()
+
+	input := bytes.NewBufferString(`{"table":"bogus","record":{"id":1}}` + "\n")
+	if _, err := driver.Import(input, &MyDatum{}); err == nil {
+		t.Fatal("Expected an error importing a record for an unknown table")
+	}
+}
+
+func TestImportStringPrimaryKey(t *testing.T) {
+	driver, cleanupFunc := reset(t, dbDriverName, dbConnectionStrings)
+	defer cleanupFunc()
+
+	input := bytes.NewBufferString(`{"table":"setting","record":{"key":"theme","value":"dark"}}` + "\n")
+	if _, err := driver.Import(input, &Setting{}); err != nil {
+		t.Fatal(err)
+	}
+	found := &Setting{}
+	if err := driver.FirstWhere(found, "key = ?", "theme"); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "dark", found.Value; actual != expected {
+		t.Errorf("Expected imported value=%q but actual=%q", expected, actual)
+	}
+}
@@ -17,6 +17,7 @@ import (
 
 	"github.com/gigawattio/go-commons/pkg/driver/repository/gormlib"
 	"github.com/gigawattio/go-commons/pkg/errorlib"
+	"github.com/gigawattio/go-commons/pkg/validation"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/jinzhu/gorm"
@@ -28,6 +29,8 @@ type (
 	// GormRepositoryDriver implements the `interfaces.RepositoryDriver` storage driver interface.
 	GormRepositoryDriver struct {
 		ConnectorFunc     DbConnectorFunc
+		NotifyChannel     string           // When non-empty, all model writes will issue a NOTIFY on this channel (postgres only).  Must be set before first use.
+		Keyring           *gormlib.Keyring // When non-nil, fields tagged with `encrypt:"true"` are encrypted at rest.  Must be set before first use.
 		driverName        string
 		connectionStrings *ring.Ring
 		currentDb         *gorm.DB
@@ -60,6 +63,17 @@ func (driver *GormRepositoryDriver) Close() (err error) {
 	return
 }
 
+// Ping verifies the database is reachable.
+func (driver *GormRepositoryDriver) Ping() error {
+	err := driver.withDb(func(db *gorm.DB) error {
+		return db.DB().Ping()
+	})
+	if err != nil {
+		return fmt.Errorf("gorm driver: png- %s", err)
+	}
+	return nil
+}
+
 func (driver *GormRepositoryDriver) db() (*gorm.DB, error) {
 	driver.lock.Lock()
 	defer driver.lock.Unlock()
@@ -71,6 +85,12 @@ func (driver *GormRepositoryDriver) db() (*gorm.DB, error) {
 		if err != nil {
 			return nil, err
 		}
+		if len(driver.NotifyChannel) > 0 {
+			gormlib.ConfigureNotifySupport(db, driver.NotifyChannel)
+		}
+		if driver.Keyring != nil {
+			gormlib.ConfigureEncryptionSupport(db, driver.Keyring)
+		}
 		driver.currentDb = db
 	}
 	return driver.currentDb, nil
@@ -148,7 +168,15 @@ func (driver *GormRepositoryDriver) inTransaction(txFuncs ...txFunc) error {
 	})
 }
 
+// Save validates and then inserts or updates value.
+//
+// Values are validated according to their `validate' struct tags and
+// `validation.Validator' implementation; invalid values are rejected with a
+// *validation.ValidationError before any SQL is run.
 func (driver *GormRepositoryDriver) Save(value interface{}) error {
+	if err := validation.Validate(value); err != nil {
+		return err
+	}
 	return driver.withDb(func(db *gorm.DB) (err error) {
 		if err = db.Save(value).Error; err != nil {
 			return
@@ -160,6 +188,11 @@ func (driver *GormRepositoryDriver) SaveMultiple(values ...interface{}) error {
 	if len(values) == 0 {
 		return nil
 	}
+	for _, value := range values {
+		if err := validation.Validate(value); err != nil {
+			return err
+		}
+	}
 	return driver.inTransaction(func(tx *gorm.DB) (err error) {
 		for _, value := range values {
 			if err = tx.Save(value).Error; err != nil {
@@ -173,7 +206,13 @@ func (driver *GormRepositoryDriver) SaveMultiple(values ...interface{}) error {
 // Update records matching `value`.
 //
 // Uses gorm's `UpdateColumns()' to avoid potential callbacks on related FK fields.
+//
+// When `values' is a struct, its non-zero fields are validated before the
+// update is run.
 func (driver *GormRepositoryDriver) Update(value interface{}, values interface{}) (rowsAffected int64, err error) {
+	if err = validation.ValidatePartial(values); err != nil {
+		return
+	}
 	err = driver.withDb(func(db *gorm.DB) (err error) {
 		res := db.Model(value).UpdateColumns(values)
 		if err = res.Error; err != nil {
@@ -192,6 +231,9 @@ func (driver *GormRepositoryDriver) Update(value interface{}, values interface{}
 //
 // Uses gorm's `UpdateColumns()' to avoid potential callbacks on related FK fields.
 func (driver *GormRepositoryDriver) UpdateSingle(value interface{}, values interface{}) error {
+	if err := validation.ValidatePartial(values); err != nil {
+		return err
+	}
 	return driver.inTransaction(func(tx *gorm.DB) (err error) {
 		scope := tx.Model(value).UpdateColumns(values)
 		if err = scope.Error; err != nil {
@@ -242,6 +284,9 @@ func (driver *GormRepositoryDriver) DeleteMultiple(values ...interface{}) (err e
 }
 
 func (driver *GormRepositoryDriver) GetOrCreate(value interface{}) (created bool, err error) {
+	if err = validation.Validate(value); err != nil {
+		return
+	}
 	err = driver.withDb(func(db *gorm.DB) (err error) {
 		if err = db.Where(value).First(value).Error; err == gorm.ErrRecordNotFound {
 			err = db.Create(value).Error
@@ -419,6 +464,96 @@ func (driver *GormRepositoryDriver) CountWhere(query interface{}, args ...interf
 	return
 }
 
+// SumWhere returns the sum of column for records of model matching the query.
+// The sum of zero records is 0.
+func (driver *GormRepositoryDriver) SumWhere(model interface{}, column string, query interface{}, args ...interface{}) (sum float64, err error) {
+	var result sql.NullFloat64
+	if err = driver.aggregateWhere(&result, "SUM", model, column, query, args...); err != nil {
+		err = fmt.Errorf("gorm driver: sumw- %s", err)
+		return
+	}
+	sum = result.Float64
+	return
+}
+
+// AvgWhere returns the average of column for records of model matching the
+// query.  The average of zero records is 0.
+func (driver *GormRepositoryDriver) AvgWhere(model interface{}, column string, query interface{}, args ...interface{}) (avg float64, err error) {
+	var result sql.NullFloat64
+	if err = driver.aggregateWhere(&result, "AVG", model, column, query, args...); err != nil {
+		err = fmt.Errorf("gorm driver: avgw- %s", err)
+		return
+	}
+	avg = result.Float64
+	return
+}
+
+// MinWhere scans the minimum value of column for records of model matching the
+// query into result.
+//
+// When no records match the minimum is NULL, so use one of the sql.Null* types
+// for result if this case needs to be distinguished.
+func (driver *GormRepositoryDriver) MinWhere(result interface{}, model interface{}, column string, query interface{}, args ...interface{}) error {
+	if err := driver.aggregateWhere(result, "MIN", model, column, query, args...); err != nil {
+		return fmt.Errorf("gorm driver: minw- %s", err)
+	}
+	return nil
+}
+
+// MaxWhere is the counterpart to MinWhere.
+func (driver *GormRepositoryDriver) MaxWhere(result interface{}, model interface{}, column string, query interface{}, args ...interface{}) error {
+	if err := driver.aggregateWhere(result, "MAX", model, column, query, args...); err != nil {
+		return fmt.Errorf("gorm driver: maxw- %s", err)
+	}
+	return nil
+}
+
+func (driver *GormRepositoryDriver) aggregateWhere(result interface{}, function string, model interface{}, column string, query interface{}, args ...interface{}) error {
+	return driver.withDb(func(db *gorm.DB) error {
+		expr := fmt.Sprintf("%v(%v)", function, db.NewScope(model).Quote(column))
+		return gormlib.WhereAlive(db.Model(model), model).Where(query, args...).Select(expr).Row().Scan(result)
+	})
+}
+
+// DistinctWhere populates values (a pointer to a slice) with the distinct,
+// ordered values of column for records of model matching the query.
+func (driver *GormRepositoryDriver) DistinctWhere(values interface{}, model interface{}, column string, query interface{}, args ...interface{}) error {
+	return driver.withDb(func(db *gorm.DB) (err error) {
+		quoted := db.NewScope(model).Quote(column)
+		err = gormlib.WhereAlive(db.Model(model), model).Where(query, args...).Order(quoted).Pluck("DISTINCT "+quoted, values).Error
+		if err != nil {
+			err = fmt.Errorf("gorm driver: dstw- %s", err)
+			return
+		}
+		return
+	})
+}
+
+// GroupWhere runs a GROUP BY query against the table for model and scans the
+// rows into results, which must be a pointer to a slice of structs.
+//
+// Columns in `selects' are matched to result struct fields by name, so
+// aggregates should be aliased, e.g.:
+//
+//     type PlanetCount struct {
+//         HomePlanet string
+//         Total      int64
+//     }
+//     results := []PlanetCount{}
+//     driver.GroupWhere(&results, &MyDatum{}, "home_planet, COUNT(*) AS total", "home_planet", &MyDatum{})
+//
+// Rows are ordered by the `groupBy' expression.
+func (driver *GormRepositoryDriver) GroupWhere(results interface{}, model interface{}, selects string, groupBy string, query interface{}, args ...interface{}) error {
+	return driver.withDb(func(db *gorm.DB) (err error) {
+		err = db.Model(model).Select(selects).Where(query, args...).Group(groupBy).Order(groupBy).Scan(results).Error
+		if err != nil {
+			err = fmt.Errorf("gorm driver: grpw- %s", err)
+			return
+		}
+		return
+	})
+}
+
 func (driver *GormRepositoryDriver) Exec(query string, args ...interface{}) error {
 	return driver.withDb(func(db *gorm.DB) (err error) {
 		if err = db.Exec(query, args...).Error; err != nil {
@@ -1,8 +1,10 @@
 package repository
 
 import (
+	"database/sql"
 	"fmt"
 	"os"
+	"reflect"
 	"regexp"
 	"strings"
 	"testing"
@@ -10,6 +12,7 @@ import (
 
 	"github.com/gigawattio/go-commons/pkg/driver/repository/gormlib"
 	"github.com/gigawattio/go-commons/pkg/testlib"
+	"github.com/gigawattio/go-commons/pkg/validation"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/jinzhu/gorm"
@@ -36,6 +39,26 @@ type (
 		MyDatumId int64 `gorm:"type:bigint REFERENCES \"my_datum\" (\"id\");not null;"`
 		TagId     int64 `gorm:"type:bigint REFERENCES \"tag\" (\"id\");not null;"`
 	}
+
+	// Widget is soft-deleted via its `Alive' column.
+	Widget struct {
+		Id     int64
+		Color  string `gorm:"type:varchar(255);not null;" validate:"required,max=32"`
+		Weight int64  `gorm:"not null;" validate:"min=0"`
+		Alive  *bool  `gorm:"DEFAULT:true;"`
+	}
+
+	Credential struct {
+		Id    int64
+		Name  string `gorm:"not null;unique;"`
+		Token string `gorm:"type:text;" encrypt:"true"`
+	}
+
+	// Setting has a non-integer primary key.
+	Setting struct {
+		Key   string `gorm:"type:varchar(255);primary_key;"`
+		Value string
+	}
 )
 
 var (
@@ -46,6 +69,9 @@ var (
 		&Tag{},
 		&MyDatum{},
 		&MyDatumTag{},
+		&Widget{},
+		&Credential{},
+		&Setting{},
 	}
 )
 
@@ -316,6 +342,201 @@ func TestM2m(t *testing.T) {
 	}
 }
 
+func TestAggregates(t *testing.T) {
+	driver, cleanupFunc := reset(t, dbDriverName, dbConnectionStrings)
+	defer cleanupFunc()
+
+	widgets := []interface{}{
+		&Widget{Color: "red", Weight: 1},
+		&Widget{Color: "red", Weight: 2},
+		&Widget{Color: "blue", Weight: 3},
+		&Widget{Color: "green", Weight: 4},
+		&Widget{Color: "green", Weight: 100}, // Soft-deleted below.
+	}
+	if err := driver.SaveMultiple(widgets...); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Delete(widgets[len(widgets)-1]); err != nil {
+		t.Fatal(err)
+	}
+
+	{
+		// NB: Unlike the aggregates, CountWhere has never excluded soft-deleted
+		// records.
+		count, err := driver.CountWhere(&Widget{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := int64(5); count != expected {
+			t.Errorf("Expected count=%v but actual=%v", expected, count)
+		}
+	}
+
+	{
+		sum, err := driver.SumWhere(&Widget{}, "weight", &Widget{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := float64(10); sum != expected {
+			t.Errorf("Expected sum=%v but actual=%v", expected, sum)
+		}
+	}
+
+	{
+		avg, err := driver.AvgWhere(&Widget{}, "weight", "color = ?", "red")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := 1.5; avg != expected {
+			t.Errorf("Expected avg=%v but actual=%v", expected, avg)
+		}
+	}
+
+	{
+		var min, max int64
+		if err := driver.MinWhere(&min, &Widget{}, "weight", &Widget{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := driver.MaxWhere(&max, &Widget{}, "weight", &Widget{}); err != nil {
+			t.Fatal(err)
+		}
+		if min != 1 || max != 4 {
+			t.Errorf("Expected min=1 and max=4 but actual min=%v max=%v", min, max)
+		}
+	}
+
+	{
+		var max sql.NullInt64
+		if err := driver.MaxWhere(&max, &Widget{}, "weight", "color = ?", "purple"); err != nil {
+			t.Fatal(err)
+		}
+		if max.Valid {
+			t.Errorf("Expected max to be NULL when no records match but actual=%v", max.Int64)
+		}
+	}
+
+	{
+		colors := []string{}
+		if err := driver.DistinctWhere(&colors, &Widget{}, "color", &Widget{}); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := []string{"blue", "green", "red"}, colors; !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected distinct colors=%v but actual=%v", expected, actual)
+		}
+	}
+
+	{
+		type ColorWeight struct {
+			Color string
+			Total int64
+			Count int64
+		}
+		results := []ColorWeight{}
+		if err := driver.GroupWhere(&results, &Widget{}, "color, SUM(weight) AS total, COUNT(*) AS count", "color", &Widget{}); err != nil {
+			t.Fatal(err)
+		}
+		expected := []ColorWeight{
+			{Color: "blue", Total: 3, Count: 1},
+			{Color: "green", Total: 4, Count: 1},
+			{Color: "red", Total: 3, Count: 2},
+		}
+		if !reflect.DeepEqual(results, expected) {
+			t.Errorf("Expected group results=%+v but actual=%+v", expected, results)
+		}
+	}
+}
+
+func TestValidation(t *testing.T) {
+	driver, cleanupFunc := reset(t, dbDriverName, dbConnectionStrings)
+	defer cleanupFunc()
+
+	if err := driver.Save(&Widget{Weight: -1}); !validation.IsValidationError(err) {
+		t.Fatalf("Expected Save to fail with a validation error but err=%v", err)
+	} else if expected, actual := 2, len(err.(*validation.ValidationError).Fields); actual != expected {
+		t.Errorf("Expected %v field errors but actual=%v: %s", expected, actual, err)
+	}
+	if _, err := driver.GetOrCreate(&Widget{Color: strings.Repeat("x", 33)}); !validation.IsValidationError(err) {
+		t.Fatalf("Expected GetOrCreate to fail with a validation error but err=%v", err)
+	}
+	count, err := driver.CountWhere(&Widget{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatalf("Expected invalid widgets to have been rejected but found count=%v", count)
+	}
+
+	widget := &Widget{Color: "red", Weight: 1}
+	if err := driver.Save(widget); err != nil {
+		t.Fatal(err)
+	}
+	// Partial updates only validate the fields being written.
+	if err := driver.UpdateSingle(widget, Widget{Weight: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.UpdateSingle(widget, Widget{Weight: -2}); !validation.IsValidationError(err) {
+		t.Fatalf("Expected UpdateSingle to fail with a validation error but err=%v", err)
+	}
+}
+
+func TestEncryption(t *testing.T) {
+	driver, cleanupFunc := reset(t, dbDriverName, dbConnectionStrings)
+	defer cleanupFunc()
+	keyring, err := gormlib.NewKeyring("k1", gormlib.GenerateRandomKey(32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver.Keyring = keyring
+
+	credential := &Credential{Name: "api", Token: "s3cr3t"}
+	if err := driver.Save(credential); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "s3cr3t", credential.Token; actual != expected {
+		t.Errorf("Expected saved struct to retain plaintext token=%q but actual=%q", expected, actual)
+	}
+
+	var stored string
+	if err := driver.Raw(&stored, `SELECT "token" FROM "credential" WHERE "id" = ?`, credential.Id); err != nil {
+		t.Fatal(err)
+	}
+	if id, encrypted := gormlib.KeyId(stored); !encrypted || id != "k1" {
+		t.Fatalf("Expected stored token to be encrypted with key id=k1 but stored=%q", stored)
+	}
+
+	// Rotate keys; records encrypted with the old key remain readable and
+	// updates are encrypted with the new key.
+	if err := keyring.AddKey("k2", gormlib.GenerateRandomKey(32)); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.SetPrimary("k2"); err != nil {
+		t.Fatal(err)
+	}
+	found := &Credential{}
+	if err := driver.FirstWhere(found, "name = ?", "api"); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "s3cr3t", found.Token; actual != expected {
+		t.Errorf("Expected decrypted token=%q but actual=%q", expected, actual)
+	}
+	if err := driver.UpdateSingle(found, Credential{Token: "r0t4t3d"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Raw(&stored, `SELECT "token" FROM "credential" WHERE "id" = ?`, credential.Id); err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := gormlib.KeyId(stored); id != "k2" {
+		t.Fatalf("Expected updated token to be encrypted with key id=k2 but stored=%q", stored)
+	}
+	founds := []Credential{}
+	if err := driver.FindWhere(&founds, &Credential{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(founds) != 1 || founds[0].Token != "r0t4t3d" {
+		t.Errorf("Expected a single credential with decrypted token but found %+v", founds)
+	}
+}
+
 func TestRawRow(t *testing.T) {
 	driver, cleanupFunc := reset(t, dbDriverName, dbConnectionStrings)
 	defer cleanupFunc()
@@ -673,3 +894,11 @@ func TestTableName(t *testing.T) {
 		t.Errorf("Expected table name='my_datum' but actual='%v'", tableName)
 	}
 }
+
+func TestPing(t *testing.T) {
+	driver, cleanupFunc := reset(t, dbDriverName, dbConnectionStrings)
+	defer cleanupFunc()
+	if err := driver.Ping(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,311 @@
+package gormlib
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/securecookie"
+	"github.com/jinzhu/gorm"
+)
+
+// EncryptTagName is the struct tag used to mark fields for encryption at rest,
+// e.g.:
+//
+//     type Account struct {
+//         Id       int64
+//         ApiToken string `encrypt:"true"`
+//     }
+//
+// Only string and []byte fields are supported.  Since ciphertexts are
+// non-deterministic, encrypted fields cannot be used in query conditions.
+const EncryptTagName = "encrypt"
+
+// encryptedPrefix identifies encrypted values.  Ciphertexts are stored as:
+//
+//     enc:<key-id>:<base64(nonce + sealed-data)>
+//
+// Values without the prefix are treated as plaintext, which allows encryption
+// to be enabled for pre-existing columns.
+const encryptedPrefix = "enc:"
+
+var (
+	UnknownKeyIdError    = errors.New("unknown encryption key id")
+	InvalidKeyIdError    = errors.New("encryption key id must be non-empty and not contain ':'")
+	MalformedCipherError = errors.New("malformed ciphertext")
+)
+
+// Keyring holds the AES-GCM keys used for field encryption.
+//
+// New values are always encrypted with the primary key.  Because the key id
+// is stored alongside each ciphertext, keys can be rotated by adding a new key,
+// making it the primary, and keeping the old keys around until all records
+// have been re-saved.
+type Keyring struct {
+	primaryId string
+	aeads     map[string]cipher.AEAD
+	lock      sync.RWMutex
+}
+
+// NewKeyring creates a keyring with a single primary key.
+//
+// Keys must be 16, 24 or 32 bytes long to select AES-128, AES-192 or AES-256,
+// see GenerateRandomKey.
+func NewKeyring(primaryId string, primaryKey []byte) (*Keyring, error) {
+	keyring := &Keyring{
+		aeads: map[string]cipher.AEAD{},
+	}
+	if err := keyring.AddKey(primaryId, primaryKey); err != nil {
+		return nil, err
+	}
+	if err := keyring.SetPrimary(primaryId); err != nil {
+		return nil, err
+	}
+	return keyring, nil
+}
+
+// AddKey adds a key which can be used for decryption, and for encryption once
+// made the primary.
+func (keyring *Keyring) AddKey(id string, key []byte) error {
+	if len(id) == 0 || strings.Contains(id, ":") {
+		return InvalidKeyIdError
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("keyring: key id=%v: %s", id, err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return fmt.Errorf("keyring: key id=%v: %s", id, err)
+	}
+
+	keyring.lock.Lock()
+	keyring.aeads[id] = aead
+	keyring.lock.Unlock()
+	return nil
+}
+
+// SetPrimary sets the key used to encrypt new values.
+func (keyring *Keyring) SetPrimary(id string) error {
+	keyring.lock.Lock()
+	defer keyring.lock.Unlock()
+
+	if _, ok := keyring.aeads[id]; !ok {
+		return UnknownKeyIdError
+	}
+	keyring.primaryId = id
+	return nil
+}
+
+// Encrypt encrypts plaintext with the primary key.
+func (keyring *Keyring) Encrypt(plaintext []byte) (string, error) {
+	keyring.lock.RLock()
+	var (
+		id   = keyring.primaryId
+		aead = keyring.aeads[id]
+	)
+	keyring.lock.RUnlock()
+
+	if aead == nil {
+		return "", UnknownKeyIdError
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("keyring: generating nonce: %s", err)
+	}
+	// Bind the ciphertext to its key id via the additional data.
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(id))
+	ciphertext := encryptedPrefix + id + ":" + base64.StdEncoding.EncodeToString(sealed)
+	return ciphertext, nil
+}
+
+// Decrypt decrypts a value produced by Encrypt using the key it was encrypted
+// with.  Values which aren't encrypted are returned as-is.
+func (keyring *Keyring) Decrypt(value string) ([]byte, error) {
+	id, encrypted := KeyId(value)
+	if !encrypted {
+		return []byte(value), nil
+	}
+	pieces := strings.SplitN(value, ":", 3)
+	if len(pieces) != 3 {
+		return nil, MalformedCipherError
+	}
+
+	keyring.lock.RLock()
+	aead, ok := keyring.aeads[id]
+	keyring.lock.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("keyring: %s: %v", UnknownKeyIdError, id)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(pieces[2])
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, MalformedCipherError
+	}
+	nonce := sealed[0:aead.NonceSize()]
+	plaintext, err := aead.Open(nil, nonce, sealed[aead.NonceSize():], []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("keyring: decrypting with key id=%v: %s", id, err)
+	}
+	return plaintext, nil
+}
+
+// KeyId extracts the key id from an encrypted value.  The second return value
+// is false when the value is not encrypted.
+func KeyId(value string) (id string, encrypted bool) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return
+	}
+	pieces := strings.SplitN(value, ":", 3)
+	if len(pieces) != 3 {
+		return
+	}
+	id, encrypted = pieces[1], true
+	return
+}
+
+// GenerateRandomKey is a convenience method which provides a pass-through to
+// the securecookie.GenerateRandomKey function.  Use a length of 32 for
+// AES-256.
+func GenerateRandomKey(length int) []byte {
+	key := securecookie.GenerateRandomKey(length)
+	return key
+}
+
+// ConfigureEncryptionSupport sets up transparent encryption of fields tagged
+// with `encrypt:"true"' for the provided db instance.  Values are encrypted
+// before being written and decrypted after being read, so the structs seen by
+// callers always contain plaintext.
+func ConfigureEncryptionSupport(db *gorm.DB, keyring *Keyring) {
+	const encryptedKey = "encryption:encrypted_value"
+
+	Encrypt := func(scope *gorm.Scope) {
+		if scope.HasError() {
+			return
+		}
+		// Partial updates (e.g. UpdateColumns) write a map of column values.
+		if attrs, ok := scope.InstanceGet("gorm:update_attrs"); ok {
+			updateAttrs := attrs.(map[string]interface{})
+			for _, field := range scope.Fields() {
+				if value, ok := updateAttrs[field.DBName]; ok && field.Tag.Get(EncryptTagName) == "true" {
+					encrypted, err := encryptValue(keyring, reflect.ValueOf(value))
+					if err != nil {
+						scope.Err(err)
+						return
+					}
+					updateAttrs[field.DBName] = encrypted.Interface()
+				}
+			}
+			return
+		}
+		if err := transformEncryptedFields(scope.IndirectValue(), func(v reflect.Value) (reflect.Value, error) { return encryptValue(keyring, v) }); err != nil {
+			scope.Err(err)
+			return
+		}
+		scope.InstanceSet(encryptedKey, true)
+	}
+
+	Decrypt := func(scope *gorm.Scope) {
+		// Always restore plaintext of values encrypted by this scope, even upon
+		// error.
+		if _, ok := scope.InstanceGet(encryptedKey); !ok && scope.HasError() {
+			return
+		}
+		if err := transformEncryptedFields(scope.IndirectValue(), func(v reflect.Value) (reflect.Value, error) { return decryptValue(keyring, v) }); err != nil {
+			scope.Err(err)
+		}
+	}
+
+	db.Callback().Create().Before("gorm:create").Register("encrypt_create", Encrypt)
+	db.Callback().Create().After("gorm:create").Register("decrypt_create", Decrypt)
+	db.Callback().Update().Before("gorm:update").Register("encrypt_update", Encrypt)
+	db.Callback().Update().After("gorm:update").Register("decrypt_update", Decrypt)
+	db.Callback().Query().After("gorm:query").Register("decrypt_query", Decrypt)
+}
+
+// transformEncryptedFields applies fn to every encrypt-tagged field of v,
+// which may be a struct or a slice of structs (or pointers to them).
+func transformEncryptedFields(v reflect.Value, fn func(reflect.Value) (reflect.Value, error)) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := transformEncryptedFields(v.Index(i), fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).Tag.Get(EncryptTagName) != "true" {
+				continue
+			}
+			field := v.Field(i)
+			if !field.CanSet() {
+				return fmt.Errorf("encryption: field %v.%v is not settable", t.Name(), t.Field(i).Name)
+			}
+			transformed, err := fn(field)
+			if err != nil {
+				return fmt.Errorf("encryption: field %v.%v: %s", t.Name(), t.Field(i).Name, err)
+			}
+			field.Set(transformed)
+		}
+	}
+	return nil
+}
+
+// encryptValue always encrypts non-empty values, even those which look like
+// ciphertexts, since models hold plaintext outside of the create and update
+// callbacks.
+func encryptValue(keyring *Keyring, v reflect.Value) (reflect.Value, error) {
+	plaintext, err := encryptableBytes(v)
+	if err != nil || len(plaintext) == 0 {
+		return v, err // Leave empty values as-is.
+	}
+	ciphertext, err := keyring.Encrypt(plaintext)
+	if err != nil {
+		return v, err
+	}
+	if v.Kind() == reflect.String {
+		return reflect.ValueOf(ciphertext).Convert(v.Type()), nil
+	}
+	return reflect.ValueOf([]byte(ciphertext)).Convert(v.Type()), nil
+}
+
+func decryptValue(keyring *Keyring, v reflect.Value) (reflect.Value, error) {
+	ciphertext, err := encryptableBytes(v)
+	if err != nil || len(ciphertext) == 0 {
+		return v, err
+	}
+	plaintext, err := keyring.Decrypt(string(ciphertext))
+	if err != nil {
+		return v, err
+	}
+	if v.Kind() == reflect.String {
+		return reflect.ValueOf(string(plaintext)).Convert(v.Type()), nil
+	}
+	return reflect.ValueOf(plaintext).Convert(v.Type()), nil
+}
+
+func encryptableBytes(v reflect.Value) ([]byte, error) {
+	switch {
+	case v.Kind() == reflect.String:
+		return []byte(v.String()), nil
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		return v.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unsupported type=%v, only string and []byte fields may be encrypted", v.Type())
+	}
+}
@@ -0,0 +1,130 @@
+package gormlib
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestKeyringRotation(t *testing.T) {
+	keyring, err := NewKeyring("k1", GenerateRandomKey(32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := []byte("my api token")
+
+	ciphertext1, err := keyring.Encrypt(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, encrypted := KeyId(ciphertext1); !encrypted || id != "k1" {
+		t.Fatalf("Expected ciphertext to be encrypted with key id=k1 but encrypted=%v id=%v", encrypted, id)
+	}
+	if strings.Contains(ciphertext1, string(plaintext)) {
+		t.Fatalf("Ciphertext contains the plaintext: %v", ciphertext1)
+	}
+
+	// Rotate to a new primary key.
+	if err := keyring.AddKey("k2", GenerateRandomKey(32)); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.SetPrimary("k2"); err != nil {
+		t.Fatal(err)
+	}
+	ciphertext2, err := keyring.Encrypt(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := KeyId(ciphertext2); id != "k2" {
+		t.Fatalf("Expected new ciphertext to use key id=k2 but id=%v", id)
+	}
+
+	// Both ciphertexts remain decryptable.
+	for _, ciphertext := range []string{ciphertext1, ciphertext2} {
+		decrypted, err := keyring.Decrypt(ciphertext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decrypted, plaintext) {
+			t.Errorf("Expected decrypted=%q but actual=%q", string(plaintext), string(decrypted))
+		}
+	}
+
+	// Plaintext passes through unmodified.
+	if decrypted, err := keyring.Decrypt("legacy value"); err != nil || string(decrypted) != "legacy value" {
+		t.Errorf("Expected unencrypted value to pass through but decrypted=%q err=%v", string(decrypted), err)
+	}
+
+	// A keyring without the original key can't decrypt.
+	other, err := NewKeyring("k2", GenerateRandomKey(32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Decrypt(ciphertext1); err == nil {
+		t.Error("Expected decryption with an unknown key id to fail")
+	}
+	if _, err := other.Decrypt(ciphertext2); err == nil {
+		t.Error("Expected decryption with the wrong key to fail")
+	}
+}
+
+func TestKeyringInvalidKeys(t *testing.T) {
+	if _, err := NewKeyring("k1", []byte("too short")); err == nil {
+		t.Error("Expected invalid key length to be rejected")
+	}
+	if _, err := NewKeyring("k:1", GenerateRandomKey(32)); err != InvalidKeyIdError {
+		t.Errorf("Expected err=%v but actual=%v", InvalidKeyIdError, err)
+	}
+	keyring, err := NewKeyring("k1", GenerateRandomKey(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.SetPrimary("missing"); err != UnknownKeyIdError {
+		t.Errorf("Expected err=%v but actual=%v", UnknownKeyIdError, err)
+	}
+}
+
+func TestTransformEncryptedFields(t *testing.T) {
+	type secret struct {
+		Name  string
+		Token string `encrypt:"true"`
+		Blob  []byte `encrypt:"true"`
+	}
+	keyring, err := NewKeyring("k1", GenerateRandomKey(32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secrets := []*secret{
+		{Name: "a", Token: "token-a", Blob: []byte("blob-a")},
+		{Name: "b"},
+		{Name: "c", Token: "enc:k1:bm90IGEgY2lwaGVydGV4dA=="},
+	}
+	encrypt := func(v reflect.Value) (reflect.Value, error) { return encryptValue(keyring, v) }
+	decrypt := func(v reflect.Value) (reflect.Value, error) { return decryptValue(keyring, v) }
+
+	if err := transformEncryptedFields(reflect.ValueOf(&secrets), encrypt); err != nil {
+		t.Fatal(err)
+	}
+	if _, encrypted := KeyId(secrets[0].Token); !encrypted || secrets[0].Name != "a" {
+		t.Fatalf("Expected only Token to be encrypted but found %+v", *secrets[0])
+	}
+	if _, encrypted := KeyId(string(secrets[0].Blob)); !encrypted {
+		t.Fatalf("Expected Blob to be encrypted but found %q", string(secrets[0].Blob))
+	}
+	if secrets[1].Token != "" || secrets[1].Blob != nil {
+		t.Fatalf("Expected empty values to be left as-is but found %+v", *secrets[1])
+	}
+	if secrets[2].Token == "enc:k1:bm90IGEgY2lwaGVydGV4dA==" {
+		t.Fatal("Expected plaintext resembling a ciphertext to be encrypted")
+	}
+
+	if err := transformEncryptedFields(reflect.ValueOf(&secrets), decrypt); err != nil {
+		t.Fatal(err)
+	}
+	if secrets[0].Token != "token-a" || string(secrets[0].Blob) != "blob-a" {
+		t.Fatalf("Expected decrypted values but found %+v", *secrets[0])
+	}
+	if secrets[2].Token != "enc:k1:bm90IGEgY2lwaGVydGV4dA==" {
+		t.Fatalf("Expected plaintext resembling a ciphertext to round-trip but found %q", secrets[2].Token)
+	}
+}
@@ -86,6 +86,17 @@ func ConfigureAliveSupport(db *gorm.DB) {
 	db.Callback().Delete().Replace("gorm:delete", Delete)
 }
 
+// WhereAlive restricts db to records of model which haven't been soft-deleted
+// via their `Alive' column.  Unlike regular queries, Count, Pluck and Row
+// queries aren't restricted automatically.
+func WhereAlive(db *gorm.DB, model interface{}) *gorm.DB {
+	scope := db.NewScope(model)
+	if scope.HasColumn("alive") {
+		return db.Where(fmt.Sprintf(`%v.%v IS NOT NULL`, scope.QuotedTableName(), scope.Quote("alive")))
+	}
+	return db
+}
+
 // IsRetriableDbError checks an error to see if it is of the retriable foundationdb variety.
 func IsRetriableDbError(err error) bool {
 	if err != nil {
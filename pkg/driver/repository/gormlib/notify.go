@@ -0,0 +1,116 @@
+package gormlib
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	ChangeActionInsert = "INSERT"
+	ChangeActionUpdate = "UPDATE"
+	ChangeActionDelete = "DELETE"
+)
+
+// ChangePayload is the JSON document transmitted as the NOTIFY payload for
+// model writes, both by the callbacks installed via `ConfigureNotifySupport'
+// and by the triggers installed via `InstallNotifyTrigger'.
+//
+// NB: Postgres limits NOTIFY payloads to 8000 bytes, which is why only the
+// primary key is sent rather than the entire record.
+type ChangePayload struct {
+	Table  string      `json:"table"`
+	Action string      `json:"action"`
+	Id     interface{} `json:"id,omitempty"`
+}
+
+// ConfigureNotifySupport sets up callbacks which issue a NOTIFY on the
+// specified channel after every create, update or delete.  The NOTIFY runs on
+// the same connection (and thus in the same transaction) as the write, so
+// listeners are only notified once the write has been committed.
+func ConfigureNotifySupport(db *gorm.DB, channel string) {
+	notify := func(action string) func(scope *gorm.Scope) {
+		return func(scope *gorm.Scope) {
+			if scope.HasError() {
+				return
+			}
+			payload := ChangePayload{
+				Table:  scope.TableName(),
+				Action: action,
+			}
+			if field := scope.PrimaryField(); field != nil && !field.IsBlank {
+				payload.Id = field.Field.Interface()
+			}
+			bs, err := json.Marshal(payload)
+			if err != nil {
+				scope.Err(fmt.Errorf("notify: marshalling payload: %s", err))
+				return
+			}
+			if _, err = scope.SQLDB().Exec(`SELECT pg_notify($1, $2)`, channel, string(bs)); err != nil {
+				scope.Err(fmt.Errorf("notify: %s", err))
+			}
+		}
+	}
+
+	db.Callback().Create().After("gorm:create").Register("notify_create", notify(ChangeActionInsert))
+	db.Callback().Update().After("gorm:update").Register("notify_update", notify(ChangeActionUpdate))
+	db.Callback().Delete().After("gorm:delete").Register("notify_delete", notify(ChangeActionDelete))
+}
+
+// InstallNotifyTrigger creates (or replaces) a row-level trigger on the named
+// table which issues a NOTIFY with a `ChangePayload' on the specified channel
+// for every insert, update or delete, including those made outside of gorm.
+func InstallNotifyTrigger(db *gorm.DB, tableName string, primaryKey string, channel string) error {
+	var (
+		scope       = db.NewScope(nil)
+		triggerName = scope.Quote("notify_" + tableName)
+		table       = scope.Quote(tableName)
+		literal     = func(s string) string { return "'" + strings.Replace(s, "'", "''", -1) + "'" }
+	)
+
+	statements := []string{
+		fmt.Sprintf(`CREATE OR REPLACE FUNCTION %[1]v() RETURNS trigger AS $$
+DECLARE
+	rec RECORD;
+BEGIN
+	IF TG_OP = 'DELETE' THEN
+		rec := OLD;
+	ELSE
+		rec := NEW;
+	END IF;
+	PERFORM pg_notify(%[2]v, json_build_object('table', TG_TABLE_NAME, 'action', TG_OP, 'id', rec.%[3]v)::text);
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql`, triggerName, literal(channel), scope.Quote(primaryKey)),
+		fmt.Sprintf(`DROP TRIGGER IF EXISTS %v ON %v`, triggerName, table),
+		fmt.Sprintf(`CREATE TRIGGER %[1]v AFTER INSERT OR UPDATE OR DELETE ON %[2]v FOR EACH ROW EXECUTE PROCEDURE %[1]v()`, triggerName, table),
+	}
+	for _, statement := range statements {
+		if err := DbExecWithRetry(db, statement).Error; err != nil {
+			return fmt.Errorf("installing notify trigger on table=%v: %s", tableName, err)
+		}
+	}
+	return nil
+}
+
+// UninstallNotifyTrigger removes a trigger previously installed by
+// `InstallNotifyTrigger'.
+func UninstallNotifyTrigger(db *gorm.DB, tableName string) error {
+	var (
+		scope       = db.NewScope(nil)
+		triggerName = scope.Quote("notify_" + tableName)
+	)
+
+	statements := []string{
+		fmt.Sprintf(`DROP TRIGGER IF EXISTS %v ON %v`, triggerName, scope.Quote(tableName)),
+		fmt.Sprintf(`DROP FUNCTION IF EXISTS %v()`, triggerName),
+	}
+	for _, statement := range statements {
+		if err := DbExecWithRetry(db, statement).Error; err != nil {
+			return fmt.Errorf("uninstalling notify trigger on table=%v: %s", tableName, err)
+		}
+	}
+	return nil
+}
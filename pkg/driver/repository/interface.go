@@ -2,6 +2,7 @@ package repository
 
 import (
 	"database/sql"
+	"io"
 )
 
 // RepositoryDriver defines the interface that must be implemented by
@@ -37,6 +38,12 @@ type RepositoryDriver interface {
 	CountRelated(model interface{}, assocatedWith string) (count int64, err error)
 
 	CountWhere(query interface{}, args ...interface{}) (count int64, err error)
+	SumWhere(model interface{}, column string, query interface{}, args ...interface{}) (sum float64, err error)
+	AvgWhere(model interface{}, column string, query interface{}, args ...interface{}) (avg float64, err error)
+	MinWhere(result interface{}, model interface{}, column string, query interface{}, args ...interface{}) (err error)
+	MaxWhere(result interface{}, model interface{}, column string, query interface{}, args ...interface{}) (err error)
+	DistinctWhere(values interface{}, model interface{}, column string, query interface{}, args ...interface{}) (err error)
+	GroupWhere(results interface{}, model interface{}, selects string, groupBy string, query interface{}, args ...interface{}) (err error)
 
 	RawRow(query string, args ...interface{}) (*sql.Row, error)
 	RawRows(query string, args ...interface{}) (*sql.Rows, error)
@@ -44,8 +51,13 @@ type RepositoryDriver interface {
 
 	Exec(query string, args ...interface{}) (err error)
 
+	Export(w io.Writer, selections ...ExportSelection) (count int64, err error)
+	Import(r io.Reader, models ...interface{}) (count int64, err error)
+
 	TableName(model interface{}) string
 	DbName() (name string, err error)
 
+	Ping() (err error)
+
 	Close() (err error)
 }
@@ -0,0 +1,376 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gigawattio/go-commons/pkg/driver/repository/gormlib"
+	"github.com/gigawattio/go-commons/pkg/errorlib"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+var (
+	DefaultMinReconnectInterval = 1 * time.Second
+	DefaultMaxReconnectInterval = 1 * time.Minute
+
+	// NotificationBufferSize is the capacity of channels returned by
+	// `GormNotifier.Subscribe'.
+	NotificationBufferSize = 100
+
+	// notifierPingInterval is how long the notifier will wait without receiving
+	// anything before verifying the connection is still alive.
+	notifierPingInterval = 90 * time.Second
+
+	NotifyUnsupportedError = errors.New("LISTEN/NOTIFY is only supported by the postgres driver")
+)
+
+type (
+	// Notification is a change event received on a LISTEN channel.
+	Notification struct {
+		Channel string
+		Payload string
+		Change  *gormlib.ChangePayload // Non-nil when the payload is a JSON-encoded gormlib.ChangePayload.
+	}
+
+	NotificationHandlerFunc func(notification *Notification)
+
+	// GormNotifier delivers postgres LISTEN/NOTIFY events to Go channels and
+	// callbacks.
+	//
+	// The underlying listener automatically reconnects after a connection is
+	// lost, and when reconnection attempts fail will rotate through the
+	// connection strings of the associated GormRepositoryDriver.
+	GormNotifier struct {
+		MinReconnectInterval time.Duration
+		MaxReconnectInterval time.Duration
+		OnReconnect          func() // Optional, invoked after the connection is re-established, since notifications may have been missed while disconnected.
+		driver               *GormRepositoryDriver
+		connectionStrings    []string
+		connectionIndex      int
+		listener             *pq.Listener
+		events               chan pq.ListenerEventType
+		handlers             map[string][]NotificationHandlerFunc
+		subscribers          map[string][]chan *Notification
+		stopChan             chan chan struct{}
+		lock                 sync.Mutex
+	}
+)
+
+// NewGormNotifier creates a notifier which uses the same database as driver.
+func NewGormNotifier(driver *GormRepositoryDriver) (*GormNotifier, error) {
+	if driver.driverName != "postgres" {
+		return nil, NotifyUnsupportedError
+	}
+	notifier := &GormNotifier{
+		MinReconnectInterval: DefaultMinReconnectInterval,
+		MaxReconnectInterval: DefaultMaxReconnectInterval,
+		driver:               driver,
+		connectionStrings:    driver.connectionStringList(),
+		handlers:             map[string][]NotificationHandlerFunc{},
+		subscribers:          map[string][]chan *Notification{},
+	}
+	return notifier, nil
+}
+
+// Start connects the notifier and begins listening on all channels which have
+// registered handlers or subscribers.
+func (notifier *GormNotifier) Start() error {
+	notifier.lock.Lock()
+	defer notifier.lock.Unlock()
+
+	if notifier.stopChan != nil {
+		return errorlib.AlreadyRunningError
+	}
+	if err := notifier.connect(); err != nil {
+		return err
+	}
+	notifier.stopChan = make(chan chan struct{})
+	go notifier.run(notifier.stopChan)
+	return nil
+}
+
+// Stop closes the listener connection and all subscriber channels.
+func (notifier *GormNotifier) Stop() error {
+	notifier.lock.Lock()
+	stopChan := notifier.stopChan
+	notifier.stopChan = nil
+	notifier.lock.Unlock()
+
+	if stopChan == nil {
+		return errorlib.NotRunningError
+	}
+	ack := make(chan struct{})
+	stopChan <- ack
+	<-ack
+
+	notifier.lock.Lock()
+	defer notifier.lock.Unlock()
+
+	err := notifier.listener.Close()
+	notifier.listener = nil
+	for channel, subscribers := range notifier.subscribers {
+		for _, subscriber := range subscribers {
+			close(subscriber)
+		}
+		delete(notifier.subscribers, channel)
+	}
+	return err
+}
+
+// Listen registers a callback for notifications received on channel.
+//
+// Callbacks are invoked serially from the notifier goroutine, so long-running
+// work should be handed off elsewhere.
+func (notifier *GormNotifier) Listen(channel string, handler NotificationHandlerFunc) error {
+	notifier.lock.Lock()
+	defer notifier.lock.Unlock()
+
+	if err := notifier.listen(channel); err != nil {
+		return err
+	}
+	notifier.handlers[channel] = append(notifier.handlers[channel], handler)
+	return nil
+}
+
+// Subscribe returns a channel which receives notifications for channel.  The
+// returned channel is closed when the notifier is stopped.
+//
+// Notifications are dropped (and a warning logged) when a subscriber falls
+// more than NotificationBufferSize notifications behind.
+func (notifier *GormNotifier) Subscribe(channel string) (<-chan *Notification, error) {
+	notifier.lock.Lock()
+	defer notifier.lock.Unlock()
+
+	if err := notifier.listen(channel); err != nil {
+		return nil, err
+	}
+	subscriber := make(chan *Notification, NotificationBufferSize)
+	notifier.subscribers[channel] = append(notifier.subscribers[channel], subscriber)
+	return subscriber, nil
+}
+
+// Unlisten stops listening on channel and removes all of its handlers and
+// subscribers.
+func (notifier *GormNotifier) Unlisten(channel string) error {
+	notifier.lock.Lock()
+	defer notifier.lock.Unlock()
+
+	if notifier.listener != nil {
+		if err := notifier.listener.Unlisten(channel); err != nil && err != pq.ErrChannelNotOpen {
+			return fmt.Errorf("gorm notifier: unlisten channel=%v: %s", channel, err)
+		}
+	}
+	for _, subscriber := range notifier.subscribers[channel] {
+		close(subscriber)
+	}
+	delete(notifier.subscribers, channel)
+	delete(notifier.handlers, channel)
+	return nil
+}
+
+// listen issues a LISTEN for channel when the notifier is connected.  Channels
+// registered before Start are listened to upon connecting.
+//
+// NB: Caller must hold notifier.lock.
+func (notifier *GormNotifier) listen(channel string) error {
+	if notifier.listener == nil {
+		return nil
+	}
+	if err := notifier.listener.Listen(channel); err != nil && err != pq.ErrChannelAlreadyOpen {
+		return fmt.Errorf("gorm notifier: listen channel=%v: %s", channel, err)
+	}
+	return nil
+}
+
+// connect opens a listener on the current connection string and listens on
+// all registered channels.
+//
+// NB: Caller must hold notifier.lock.
+func (notifier *GormNotifier) connect() error {
+	if len(notifier.connectionStrings) == 0 {
+		return errors.New("gorm notifier: no connection strings available")
+	}
+	connectionString := notifier.connectionStrings[notifier.connectionIndex%len(notifier.connectionStrings)]
+	log.Debugf("gorm notifier: connecting with connection string=%s", connectionString)
+
+	events := make(chan pq.ListenerEventType, 1)
+	eventCallback := func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Infof("gorm notifier: listener event=%v: %s", event, err)
+		}
+		select {
+		case events <- event:
+		default:
+		}
+	}
+	listener := pq.NewListener(connectionString, notifier.MinReconnectInterval, notifier.MaxReconnectInterval, eventCallback)
+
+	channels := map[string]struct{}{}
+	for channel := range notifier.handlers {
+		channels[channel] = struct{}{}
+	}
+	for channel := range notifier.subscribers {
+		channels[channel] = struct{}{}
+	}
+	for channel := range channels {
+		if err := listener.Listen(channel); err != nil && err != pq.ErrChannelAlreadyOpen {
+			listener.Close()
+			return fmt.Errorf("gorm notifier: listen channel=%v: %s", channel, err)
+		}
+	}
+	notifier.listener = listener
+	notifier.events = events
+	return nil
+}
+
+// rotate replaces the listener with one connected via the next connection
+// string.
+//
+// NB: Caller must hold notifier.lock.
+func (notifier *GormNotifier) rotate() {
+	if len(notifier.connectionStrings) < 2 {
+		return // Nothing to rotate to, pq.Listener will keep retrying on its own.
+	}
+	previous := notifier.listener
+	notifier.connectionIndex++
+	if err := notifier.connect(); err != nil {
+		log.Errorf("gorm notifier: rotating connection string: %s", err)
+		return
+	}
+	if err := previous.Close(); err != nil {
+		log.Infof("gorm notifier: closing previous listener: %s", err)
+	}
+}
+
+func (notifier *GormNotifier) run(stopChan chan chan struct{}) {
+	for {
+		notifier.lock.Lock()
+		var (
+			notifications = notifier.listener.NotificationChannel()
+			events        = notifier.events
+		)
+		notifier.lock.Unlock()
+
+		select {
+		case ack := <-stopChan:
+			ack <- struct{}{}
+			return
+
+		case pqNotification := <-notifications:
+			if pqNotification == nil {
+				// pq sends nil after re-establishing a lost connection.
+				if notifier.OnReconnect != nil {
+					notifier.OnReconnect()
+				}
+				continue
+			}
+			notifier.dispatch(newNotification(pqNotification))
+
+		case event := <-events:
+			if event == pq.ListenerEventConnectionAttemptFailed {
+				notifier.lock.Lock()
+				notifier.rotate()
+				notifier.lock.Unlock()
+			}
+
+		case <-time.After(notifierPingInterval):
+			notifier.lock.Lock()
+			listener := notifier.listener
+			notifier.lock.Unlock()
+			go func() {
+				if err := listener.Ping(); err != nil {
+					log.Infof("gorm notifier: ping failed: %s", err)
+				}
+			}()
+		}
+	}
+}
+
+func (notifier *GormNotifier) dispatch(notification *Notification) {
+	notifier.lock.Lock()
+	var (
+		handlers    = append([]NotificationHandlerFunc{}, notifier.handlers[notification.Channel]...)
+		subscribers = append([]chan *Notification{}, notifier.subscribers[notification.Channel]...)
+	)
+	for _, subscriber := range subscribers {
+		select {
+		case subscriber <- notification:
+		default:
+			log.Warningf("gorm notifier: dropped notification for slow subscriber on channel=%v", notification.Channel)
+		}
+	}
+	notifier.lock.Unlock()
+
+	for _, handler := range handlers {
+		handler(notification)
+	}
+}
+
+func newNotification(pqNotification *pq.Notification) *Notification {
+	notification := &Notification{
+		Channel: pqNotification.Channel,
+		Payload: pqNotification.Extra,
+	}
+	change := &gormlib.ChangePayload{}
+	if err := json.Unmarshal([]byte(pqNotification.Extra), change); err == nil && len(change.Table) > 0 && len(change.Action) > 0 {
+		notification.Change = change
+	}
+	return notification
+}
+
+// Notify sends a NOTIFY with the given payload on channel.
+func (driver *GormRepositoryDriver) Notify(channel string, payload string) error {
+	return driver.withDb(func(db *gorm.DB) (err error) {
+		if err = db.Exec(`SELECT pg_notify(?, ?)`, channel, payload).Error; err != nil {
+			err = fmt.Errorf("gorm driver: ntf- %s", err)
+			return
+		}
+		return
+	})
+}
+
+// InstallNotifyTrigger installs a database trigger which issues a NOTIFY on
+// channel for every write to the table backing model, including writes which
+// don't go through this driver.
+func (driver *GormRepositoryDriver) InstallNotifyTrigger(model interface{}, channel string) error {
+	return driver.withDb(func(db *gorm.DB) (err error) {
+		scope := db.NewScope(model)
+		if err = gormlib.InstallNotifyTrigger(db, scope.TableName(), scope.PrimaryKey(), channel); err != nil {
+			err = fmt.Errorf("gorm driver: int- %s", err)
+			return
+		}
+		return
+	})
+}
+
+// UninstallNotifyTrigger removes a trigger installed by InstallNotifyTrigger.
+func (driver *GormRepositoryDriver) UninstallNotifyTrigger(model interface{}) error {
+	return driver.withDb(func(db *gorm.DB) (err error) {
+		if err = gormlib.UninstallNotifyTrigger(db, db.NewScope(model).TableName()); err != nil {
+			err = fmt.Errorf("gorm driver: unt- %s", err)
+			return
+		}
+		return
+	})
+}
+
+// connectionStringList returns the configured connection strings, starting
+// with the one which will be used for the next connection attempt.
+func (driver *GormRepositoryDriver) connectionStringList() []string {
+	driver.lock.Lock()
+	defer driver.lock.Unlock()
+
+	connectionStrings := []string{}
+	driver.connectionStrings.Do(func(value interface{}) {
+		if connectionString, ok := value.(string); ok {
+			connectionStrings = append(connectionStrings, connectionString)
+		}
+	})
+	return connectionStrings
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gigawattio/go-commons/pkg/driver/repository/gormlib"
+)
+
+const notifyTestChannel = "my_datum_changes"
+
+func receiveNotification(t *testing.T, notifications <-chan *Notification) *Notification {
+	select {
+	case notification := <-notifications:
+		return notification
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for notification")
+	}
+	return nil
+}
+
+func TestNotifyOnWrite(t *testing.T) {
+	driver, cleanupFunc := reset(t, dbDriverName, dbConnectionStrings)
+	defer cleanupFunc()
+	driver.NotifyChannel = notifyTestChannel
+
+	notifier, err := NewGormNotifier(driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifications, err := notifier.Subscribe(notifyTestChannel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := notifier.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := notifier.Stop(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	myDatum := &MyDatum{Name: "Notify Me"}
+	if err := driver.Save(myDatum); err != nil {
+		t.Fatal(err)
+	}
+	notification := receiveNotification(t, notifications)
+	if notification.Change == nil {
+		t.Fatalf("Expected notification to contain a change payload but payload=%q", notification.Payload)
+	}
+	if expected, actual := gormlib.ChangeActionInsert, notification.Change.Action; actual != expected {
+		t.Errorf("Expected change action=%v but actual=%v", expected, actual)
+	}
+	if expected, actual := driver.TableName(myDatum), notification.Change.Table; actual != expected {
+		t.Errorf("Expected change table=%v but actual=%v", expected, actual)
+	}
+	if expected, actual := float64(myDatum.Id), notification.Change.Id; actual != expected {
+		t.Errorf("Expected change id=%v but actual=%v", expected, actual)
+	}
+
+	if err := driver.Delete(myDatum); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := gormlib.ChangeActionDelete, receiveNotification(t, notifications).Change.Action; actual != expected {
+		t.Errorf("Expected change action=%v but actual=%v", expected, actual)
+	}
+}
+
+func TestNotifyTrigger(t *testing.T) {
+	driver, cleanupFunc := reset(t, dbDriverName, dbConnectionStrings)
+	defer cleanupFunc()
+
+	if err := driver.InstallNotifyTrigger(&Tag{}, notifyTestChannel); err != nil {
+		t.Fatal(err)
+	}
+
+	notifier, err := NewGormNotifier(driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan *Notification, 1)
+	if err := notifier.Listen(notifyTestChannel, func(notification *Notification) { received <- notification }); err != nil {
+		t.Fatal(err)
+	}
+	if err := notifier.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := notifier.Stop(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// Write via raw SQL to ensure the trigger rather than a callback is at work.
+	if err := driver.Exec(`INSERT INTO "tag" ("name") VALUES (?)`, "triggered"); err != nil {
+		t.Fatal(err)
+	}
+	notification := receiveNotification(t, received)
+	if notification.Change == nil {
+		t.Fatalf("Expected notification to contain a change payload but payload=%q", notification.Payload)
+	}
+	if expected, actual := gormlib.ChangeActionInsert, notification.Change.Action; actual != expected {
+		t.Errorf("Expected change action=%v but actual=%v", expected, actual)
+	}
+	if expected, actual := "tag", notification.Change.Table; actual != expected {
+		t.Errorf("Expected change table=%v but actual=%v", expected, actual)
+	}
+
+	if err := driver.UninstallNotifyTrigger(&Tag{}); err != nil {
+		t.Fatal(err)
+	}
+}
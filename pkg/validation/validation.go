@@ -0,0 +1,536 @@
+// Package validation provides struct-tag and interface based validation of
+// values before they are persisted or otherwise acted upon.
+//
+// Rules are declared with the `validate' struct tag as a comma-separated list,
+// e.g.:
+//
+//     type User struct {
+//         Name  string `validate:"required,max=64"`
+//         Email string `validate:"required,email"`
+//     }
+//
+// Supported rules:
+//     - required: value must not be the zero value.
+//     - min=N:    numbers must be >= N, strings, slices and maps must have a
+//                 length >= N.
+//     - max=N:    numbers must be <= N, strings, slices and maps must have a
+//                 length <= N.
+//     - len=N:    strings, slices and maps must have a length of exactly N.
+//     - email:    value must look like an email address.
+//     - enum=A|B: value must be one of the pipe-separated values.
+//     - regexp=E: strings must match the regular expression E.  As E may
+//                 contain commas it consumes the rest of the tag, so it must
+//                 be the last rule.
+//
+// Apart from "required", rules are not applied to empty strings and (for enum)
+// zero values.
+//
+// Nested structs, pointers to structs and slices of them are validated too,
+// with fields named by their path, e.g. "address.city" or "items[2].name".
+//
+// Additionally, values implementing the `Validator' interface (including
+// nested ones) have their `Validate()' method invoked.
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const TagName = "validate"
+
+// Validator is implemented by types which know how to validate themselves.
+//
+// Returning a *ValidationError will cause the field errors to be merged with
+// any produced by struct-tag rules.
+type Validator interface {
+	Validate() error
+}
+
+// FieldError describes a single invalid field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationError is the structured error produced when one or more fields are
+// invalid.
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (ve *ValidationError) Error() string {
+	messages := make([]string, len(ve.Fields))
+	for i, fieldError := range ve.Fields {
+		if len(fieldError.Field) > 0 {
+			messages[i] = fieldError.Field + ": " + fieldError.Message
+		} else {
+			messages[i] = fieldError.Message
+		}
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+// Add appends a field error.
+func (ve *ValidationError) Add(field string, rule string, message string) {
+	ve.Fields = append(ve.Fields, FieldError{Field: field, Rule: rule, Message: message})
+}
+
+// IsValidationError returns true when err is a *ValidationError.
+func IsValidationError(err error) bool {
+	_, ok := err.(*ValidationError)
+	return ok
+}
+
+var emailExpr = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+// Validate checks all struct-tag rules on value (which must be a struct or a
+// pointer to one) and then invokes `Validate()' if value is a Validator.
+//
+// Returns a *ValidationError when value is invalid.
+func Validate(value interface{}) error {
+	return validate(value, false)
+}
+
+// ValidatePartial is like Validate except that zero-valued fields are skipped
+// and `Validator' implementations are not invoked.  This is useful for
+// partial structs such as those passed to update operations, where only
+// non-zero fields are written.
+func ValidatePartial(value interface{}) error {
+	return validate(value, true)
+}
+
+func validate(value interface{}, partial bool) error {
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var (
+		ve      = &ValidationError{}
+		visited = map[visit]bool{}
+	)
+	if root := reflect.ValueOf(value); root.Kind() == reflect.Ptr {
+		visited[visit{root.Pointer(), root.Type()}] = true
+	}
+	if err := validateStruct(ve, v, "", partial, visited); err != nil {
+		return err
+	}
+	if !partial {
+		if validator, ok := value.(Validator); ok {
+			addValidatorErrors(ve, "", validator.Validate())
+		}
+	}
+	if len(ve.Fields) > 0 {
+		return ve
+	}
+	return nil
+}
+
+// visit identifies a pointer being validated, to detect cyclic references.
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+// validateStruct checks the fields of the struct v, naming them with prefix.
+func validateStruct(ve *ValidationError, v reflect.Value, prefix string, partial bool, visited map[visit]bool) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+		tag := structField.Tag.Get(TagName)
+		if tag == "-" || len(structField.PkgPath) > 0 {
+			continue // Skip excluded and unexported fields.
+		}
+		field := v.Field(i)
+		if partial && isZero(field) {
+			continue
+		}
+		name := prefix + fieldName(structField)
+		if embedded := indirect(field); structField.Anonymous && embedded.IsValid() && embedded.Kind() == reflect.Struct && len(strings.Split(structField.Tag.Get("json"), ",")[0]) == 0 {
+			// Embedded struct fields are promoted, as in JSON.  NB: So is the
+			// embedded `Validate()' method, which is invoked for v.
+			if err := validateStruct(ve, embedded, prefix, partial, visited); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, rule := range splitRules(tag) {
+			var (
+				ruleName = rule
+				param    string
+			)
+			if idx := strings.Index(rule, "="); idx != -1 {
+				ruleName, param = rule[0:idx], rule[idx+1:]
+			}
+			message, err := check(ruleName, param, field)
+			if err != nil {
+				return fmt.Errorf("validation: field %v.%v: %s", t.Name(), structField.Name, err)
+			}
+			if len(message) > 0 {
+				ve.Add(name, ruleName, message)
+			}
+		}
+		if !needsValidation(structField.Type) {
+			continue
+		}
+		if err := validateNested(ve, field, name, partial, visited); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateNested validates field when it is (a pointer to) a struct, or a
+// slice or array of them.  Pointers already being validated further up, i.e.
+// back-references, are skipped.
+func validateNested(ve *ValidationError, field reflect.Value, name string, partial bool, visited map[visit]bool) error {
+	for field.Kind() == reflect.Ptr || field.Kind() == reflect.Interface {
+		if field.IsNil() {
+			return nil
+		}
+		if field.Kind() == reflect.Ptr {
+			key := visit{field.Pointer(), field.Type()}
+			if visited[key] {
+				return nil
+			}
+			visited[key] = true
+			defer delete(visited, key)
+		}
+		field = field.Elem()
+	}
+	switch field.Kind() {
+	case reflect.Struct:
+		prefix := name
+		if len(prefix) > 0 {
+			prefix += "."
+		}
+		if err := validateStruct(ve, field, prefix, partial, visited); err != nil {
+			return err
+		}
+		if !partial {
+			if validator, ok := asValidator(field); ok {
+				addValidatorErrors(ve, name, validator.Validate())
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < field.Len(); i++ {
+			if err := validateNested(ve, field.Index(i), fmt.Sprintf("%v[%v]", name, i), partial, visited); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+var (
+	validatorType = reflect.TypeOf((*Validator)(nil)).Elem()
+
+	needsValidationCache     = map[reflect.Type]bool{}
+	needsValidationCacheLock sync.RWMutex
+)
+
+// needsValidation reports whether values of type t (or the elements of slices
+// and arrays of t) may be invalid, i.e. are structs which have tagged fields,
+// implement Validator or contain fields which need validation.  The result is
+// cached as the same types are validated repeatedly.
+func needsValidation(t reflect.Type) bool {
+	needsValidationCacheLock.RLock()
+	result, ok := needsValidationCache[t]
+	needsValidationCacheLock.RUnlock()
+	if ok {
+		return result
+	}
+	result = typeNeedsValidation(t, map[reflect.Type]bool{})
+	needsValidationCacheLock.Lock()
+	needsValidationCache[t] = result
+	needsValidationCacheLock.Unlock()
+	return result
+}
+
+func typeNeedsValidation(t reflect.Type, seen map[reflect.Type]bool) bool {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Interface:
+		return true // Depends on the dynamic value.
+	case reflect.Struct:
+	default:
+		return false
+	}
+	if seen[t] {
+		return false // Already being inspected further up.
+	}
+	seen[t] = true
+	if t.Implements(validatorType) || reflect.PtrTo(t).Implements(validatorType) {
+		return true
+	}
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+		tag := structField.Tag.Get(TagName)
+		if tag == "-" || len(structField.PkgPath) > 0 {
+			continue
+		}
+		if len(tag) > 0 || typeNeedsValidation(structField.Type, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// asValidator returns v as a Validator, preferring its pointer (for methods
+// with pointer receivers) when v is addressable.
+func asValidator(v reflect.Value) (Validator, bool) {
+	if v.CanAddr() {
+		if validator, ok := v.Addr().Interface().(Validator); ok {
+			return validator, true
+		}
+	}
+	if v.CanInterface() {
+		validator, ok := v.Interface().(Validator)
+		return validator, ok
+	}
+	return nil, false
+}
+
+// addValidatorErrors adds the error returned by a Validator for the field name
+// (the empty string for the top-level value).
+func addValidatorErrors(ve *ValidationError, name string, err error) {
+	if err == nil {
+		return
+	}
+	fieldsErr, ok := err.(*ValidationError)
+	if !ok {
+		ve.Add(name, "validate", err.Error())
+		return
+	}
+	for _, fieldError := range fieldsErr.Fields {
+		switch {
+		case len(name) == 0:
+		case len(fieldError.Field) == 0:
+			fieldError.Field = name
+		default:
+			fieldError.Field = name + "." + fieldError.Field
+		}
+		ve.Fields = append(ve.Fields, fieldError)
+	}
+}
+
+// splitRules splits a tag into its rules.  A regexp rule consumes the rest of
+// the tag.
+func splitRules(tag string) []string {
+	rules := []string{}
+	pieces := strings.Split(tag, ",")
+	for i, rule := range pieces {
+		if strings.HasPrefix(strings.TrimSpace(rule), "regexp=") {
+			rules = append(rules, strings.TrimLeft(strings.Join(pieces[i:], ","), " \t"))
+			break
+		}
+		if rule = strings.TrimSpace(rule); len(rule) > 0 {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// check applies a single rule to a field and returns a non-empty message when
+// the field is invalid.  A non-nil error indicates the rule itself is invalid.
+func check(rule string, param string, field reflect.Value) (message string, err error) {
+	switch rule {
+	case "required":
+		if isZero(field) {
+			message = "is required"
+		}
+
+	case "min", "max":
+		var limit float64
+		if limit, err = strconv.ParseFloat(param, 64); err != nil {
+			err = fmt.Errorf("invalid %v parameter %q: %s", rule, param, err)
+			return
+		}
+		field = indirect(field)
+		if !field.IsValid() {
+			return
+		}
+		if field.Kind() == reflect.String && field.Len() == 0 {
+			return // Use "required" to reject empty values.
+		}
+		var (
+			measured float64
+			noun     string
+		)
+		switch field.Kind() {
+		case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+			measured, noun = float64(field.Len()), "length "
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			measured = float64(field.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			measured = float64(field.Uint())
+		case reflect.Float32, reflect.Float64:
+			measured = field.Float()
+		default:
+			err = fmt.Errorf("rule %v is not applicable to kind=%v", rule, field.Kind())
+			return
+		}
+		if rule == "min" && measured < limit {
+			message = fmt.Sprintf("%smust be at least %v", noun, param)
+		} else if rule == "max" && measured > limit {
+			message = fmt.Sprintf("%smust be at most %v", noun, param)
+		}
+
+	case "len":
+		var length int
+		if length, err = strconv.Atoi(param); err != nil {
+			err = fmt.Errorf("invalid %v parameter %q: %s", rule, param, err)
+			return
+		}
+		field = indirect(field)
+		if !field.IsValid() {
+			return
+		}
+		switch field.Kind() {
+		case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		default:
+			err = fmt.Errorf("rule %v is not applicable to kind=%v", rule, field.Kind())
+			return
+		}
+		if field.Kind() == reflect.String && field.Len() == 0 {
+			return // Use "required" to reject empty values.
+		}
+		if field.Len() != length {
+			message = fmt.Sprintf("length must be exactly %v", length)
+		}
+
+	case "regexp":
+		var expr *regexp.Regexp
+		if expr, err = compile(param); err != nil {
+			err = fmt.Errorf("invalid %v parameter %q: %s", rule, param, err)
+			return
+		}
+		field = indirect(field)
+		if !field.IsValid() {
+			return
+		}
+		if field.Kind() != reflect.String {
+			err = fmt.Errorf("rule %v is not applicable to kind=%v", rule, field.Kind())
+			return
+		}
+		if field.Len() == 0 {
+			return // Use "required" to reject empty values.
+		}
+		if !expr.MatchString(field.String()) {
+			message = fmt.Sprintf("must match %v", param)
+		}
+
+	case "enum":
+		values := strings.Split(param, "|")
+		field = indirect(field)
+		if !field.IsValid() || isZero(field) {
+			return // Use "required" to reject empty values.
+		}
+		switch field.Kind() {
+		case reflect.String, reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		default:
+			err = fmt.Errorf("rule %v is not applicable to kind=%v", rule, field.Kind())
+			return
+		}
+		actual := fmt.Sprint(field.Interface())
+		for _, value := range values {
+			if value == actual {
+				return
+			}
+		}
+		message = fmt.Sprintf("must be one of: %v", strings.Join(values, ", "))
+
+	case "email":
+		field = indirect(field)
+		if !field.IsValid() {
+			return
+		}
+		if field.Kind() != reflect.String {
+			err = fmt.Errorf("rule %v is not applicable to kind=%v", rule, field.Kind())
+			return
+		}
+		if field.Len() == 0 {
+			return // Use "required" to reject empty values.
+		}
+		if !emailExpr.MatchString(field.String()) {
+			message = "must be a valid email address"
+		}
+
+	default:
+		err = fmt.Errorf("unrecognized rule %q", rule)
+	}
+	return
+}
+
+var (
+	exprs     = map[string]*regexp.Regexp{}
+	exprsLock sync.Mutex
+)
+
+// compile compiles regexp rule expressions, caching them as the same tags are
+// validated repeatedly.
+func compile(expr string) (*regexp.Regexp, error) {
+	exprsLock.Lock()
+	defer exprsLock.Unlock()
+	if compiled, ok := exprs[expr]; ok {
+		return compiled, nil
+	}
+	compiled, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	exprs[expr] = compiled
+	return compiled, nil
+}
+
+// fieldName returns the name used to identify a field in errors, preferring
+// the JSON name when present.
+func fieldName(structField reflect.StructField) string {
+	if jsonTag := structField.Tag.Get("json"); len(jsonTag) > 0 {
+		if name := strings.Split(jsonTag, ",")[0]; len(name) > 0 && name != "-" {
+			return name
+		}
+	}
+	return structField.Name
+}
+
+// indirect dereferences pointers, returning an invalid reflect.Value for nil.
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map, reflect.Chan, reflect.Func:
+		if v.IsNil() {
+			return true
+		}
+		if v.Kind() == reflect.Slice || v.Kind() == reflect.Map {
+			return v.Len() == 0
+		}
+		return false
+	case reflect.String:
+		return v.Len() == 0
+	}
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
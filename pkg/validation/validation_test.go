@@ -0,0 +1,255 @@
+package validation
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type account struct {
+	Name    string   `json:"name" validate:"required,max=8"`
+	Email   string   `json:"email" validate:"email"`
+	Age     int      `validate:"min=13,max=130"`
+	Tags    []string `validate:"max=2"`
+	Ignored string
+	reject  bool
+}
+
+func (a *account) Validate() error {
+	if a.reject {
+		return errors.New("rejected by Validate()")
+	}
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		value    interface{}
+		expected []FieldError
+	}{
+		{
+			value: &account{Name: "jay", Email: "jay@example.com", Age: 30},
+		},
+		{
+			value: &account{Email: "not-an-email", Age: 5, Tags: []string{"a", "b", "c"}},
+			expected: []FieldError{
+				{Field: "name", Rule: "required", Message: "is required"},
+				{Field: "email", Rule: "email", Message: "must be a valid email address"},
+				{Field: "Age", Rule: "min", Message: "must be at least 13"},
+				{Field: "Tags", Rule: "max", Message: "length must be at most 2"},
+			},
+		},
+		{
+			value: &account{Name: "much too long", Age: 200, reject: true},
+			expected: []FieldError{
+				{Field: "name", Rule: "max", Message: "length must be at most 8"},
+				{Field: "Age", Rule: "max", Message: "must be at most 130"},
+				{Field: "", Rule: "validate", Message: "rejected by Validate()"},
+			},
+		},
+		{
+			value: "not a struct",
+		},
+	}
+	for i, testCase := range testCases {
+		err := Validate(testCase.value)
+		if testCase.expected == nil {
+			if err != nil {
+				t.Errorf("[i=%v] Expected no error but got: %s", i, err)
+			}
+			continue
+		}
+		ve, ok := err.(*ValidationError)
+		if !ok {
+			t.Errorf("[i=%v] Expected *ValidationError but got %T: %v", i, err, err)
+			continue
+		}
+		if !reflect.DeepEqual(ve.Fields, testCase.expected) {
+			t.Errorf("[i=%v] Expected fields=%+v but actual=%+v", i, testCase.expected, ve.Fields)
+		}
+	}
+}
+
+func TestValidatePartial(t *testing.T) {
+	// Zero-valued fields are skipped, so "required" is not enforced.
+	if err := ValidatePartial(account{Age: 50, reject: true}); err != nil {
+		t.Errorf("Expected no error for partial value but got: %s", err)
+	}
+	if err := ValidatePartial(account{Age: 5}); !IsValidationError(err) {
+		t.Errorf("Expected a ValidationError for partial value with invalid Age but got: %v", err)
+	}
+}
+
+func TestValidateInvalidRule(t *testing.T) {
+	type broken struct {
+		Name string `validate:"bogus"`
+	}
+	err := Validate(broken{Name: "x"})
+	if err == nil {
+		t.Fatal("Expected an error for an unrecognized rule")
+	}
+	if IsValidationError(err) {
+		t.Errorf("Expected a plain error for an unrecognized rule but got a ValidationError: %s", err)
+	}
+}
+
+type address struct {
+	City    string `json:"city" validate:"required"`
+	Country string `json:"country" validate:"len=2"`
+}
+
+func (a address) Validate() error {
+	if a.City == "Atlantis" {
+		return &ValidationError{Fields: []FieldError{{Field: "city", Rule: "exists", Message: "must exist"}}}
+	}
+	return nil
+}
+
+type lineItem struct {
+	Sku string `json:"sku" validate:"required,regexp=^[A-Z]{3}-[0-9]{1,4}$"`
+}
+
+type Audit struct {
+	Note string `json:"note" validate:"max=4"`
+}
+
+type order struct {
+	Audit
+	Status   string     `json:"status" validate:"required,enum=new|paid|shipped"`
+	Priority int        `json:"priority" validate:"enum=1|2|3"`
+	Billing  address    `json:"billing"`
+	Shipping *address   `json:"shipping"`
+	Items    []lineItem `json:"items" validate:"min=1"`
+}
+
+func TestValidateRulesAndNesting(t *testing.T) {
+	testCases := []struct {
+		value    interface{}
+		expected []FieldError
+	}{
+		{
+			value: &order{Status: "new", Billing: address{City: "Oslo", Country: "NO"}, Items: []lineItem{{Sku: "ABC-12"}}},
+		},
+		{
+			value: &order{
+				Audit:    Audit{Note: "too long"},
+				Status:   "lost",
+				Priority: 7,
+				Billing:  address{Country: "NOR"},
+				Shipping: &address{City: "Atlantis", Country: "GR"},
+				Items:    []lineItem{{Sku: "ABC-12"}, {Sku: "abc"}, {}},
+			},
+			expected: []FieldError{
+				{Field: "note", Rule: "max", Message: "length must be at most 4"},
+				{Field: "status", Rule: "enum", Message: "must be one of: new, paid, shipped"},
+				{Field: "priority", Rule: "enum", Message: "must be one of: 1, 2, 3"},
+				{Field: "billing.city", Rule: "required", Message: "is required"},
+				{Field: "billing.country", Rule: "len", Message: "length must be exactly 2"},
+				{Field: "shipping.city", Rule: "exists", Message: "must exist"},
+				{Field: "items[1].sku", Rule: "regexp", Message: "must match ^[A-Z]{3}-[0-9]{1,4}$"},
+				{Field: "items[2].sku", Rule: "required", Message: "is required"},
+			},
+		},
+	}
+	for i, testCase := range testCases {
+		err := Validate(testCase.value)
+		if testCase.expected == nil {
+			if err != nil {
+				t.Errorf("[i=%v] Expected no error but got: %s", i, err)
+			}
+			continue
+		}
+		ve, ok := err.(*ValidationError)
+		if !ok {
+			t.Errorf("[i=%v] Expected *ValidationError but got %T: %v", i, err, err)
+			continue
+		}
+		if !reflect.DeepEqual(ve.Fields, testCase.expected) {
+			t.Errorf("[i=%v] Expected fields=%+v but actual=%+v", i, testCase.expected, ve.Fields)
+		}
+	}
+}
+
+func TestValidateEmptyStrings(t *testing.T) {
+	type optional struct {
+		Code    string   `validate:"min=3,max=8"`
+		Country string   `validate:"len=2"`
+		Tags    []string `validate:"min=1"`
+	}
+	// Empty strings are only rejected by "required", unlike empty slices.
+	err := Validate(&optional{})
+	ve, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("Expected *ValidationError but got %T: %v", err, err)
+	}
+	expected := []FieldError{
+		{Field: "Tags", Rule: "min", Message: "length must be at least 1"},
+	}
+	if !reflect.DeepEqual(ve.Fields, expected) {
+		t.Errorf("Expected fields=%+v but actual=%+v", expected, ve.Fields)
+	}
+	if err := Validate(&optional{Code: "ab", Country: "NOR", Tags: []string{"a"}}); !IsValidationError(err) || len(err.(*ValidationError).Fields) != 2 {
+		t.Errorf("Expected a ValidationError for Code and Country but got: %v", err)
+	}
+}
+
+func TestValidateInvalidRegexp(t *testing.T) {
+	type broken struct {
+		Code string `validate:"regexp=[a-"`
+	}
+	if err := Validate(broken{Code: "x"}); err == nil || IsValidationError(err) {
+		t.Errorf("Expected a plain error for an invalid regexp but got: %v", err)
+	}
+}
+
+type author struct {
+	Name  string `json:"name" validate:"required"`
+	Posts []post `json:"posts"`
+}
+
+type post struct {
+	Title  string  `json:"title" validate:"required"`
+	Author *author `json:"author"`
+}
+
+func TestValidateCyclic(t *testing.T) {
+	a := &author{Name: "Ann"}
+	a.Posts = []post{{Title: "First", Author: a}, {Author: a}}
+
+	done := make(chan error, 1)
+	go func() { done <- Validate(a) }()
+	select {
+	case err := <-done:
+		ve, ok := err.(*ValidationError)
+		if !ok {
+			t.Fatalf("Expected *ValidationError but got %T: %v", err, err)
+		}
+		expected := []FieldError{{Field: "posts[1].title", Rule: "required", Message: "is required"}}
+		if !reflect.DeepEqual(ve.Fields, expected) {
+			t.Errorf("Expected fields=%+v but actual=%+v", expected, ve.Fields)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out validating a cyclic value")
+	}
+}
+
+func TestNeedsValidation(t *testing.T) {
+	type untagged struct {
+		Name  string
+		Posts []post
+	}
+	testCases := map[reflect.Type]bool{
+		reflect.TypeOf(time.Time{}):       false,
+		reflect.TypeOf(struct{ A int }{}): false,
+		reflect.TypeOf(&author{}):         true,
+		reflect.TypeOf([]address{}):       true, // Validator.
+		reflect.TypeOf(untagged{}):        true, // Contains tagged fields.
+		reflect.TypeOf(""):                false,
+	}
+	for typ, expected := range testCases {
+		if actual := needsValidation(typ); actual != expected {
+			t.Errorf("Expected needsValidation(%v)=%v but actual=%v", typ, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+type AccessLogFormat int
+
+const (
+	AccessLogLogrus   AccessLogFormat = iota // one structured logrus entry per request.
+	AccessLogCombined                        // Apache combined log format.
+	AccessLogJson                            // one JSON object per line.
+)
+
+type AccessLogOptions struct {
+	Format         AccessLogFormat
+	Logger         *log.Logger                            // logger for AccessLogLogrus, log.StandardLogger() if nil.
+	Output         io.Writer                              // destination for AccessLogCombined and AccessLogJson, os.Stdout if nil.
+	TrustedProxies []string                               // IPs or CIDRs of proxies whose X-Forwarded-For and X-Real-IP headers are honoured.
+	UserIdFunc     func(req *http.Request) (int64, error) // optional user ID lookup, e.g. `cookieAuth.Read'.
+}
+
+// AccessLog emits one log entry per request.
+type AccessLog struct {
+	Options        AccessLogOptions
+	trustedProxies []*net.IPNet
+	lock           sync.Mutex // Serializes writes to Output.
+}
+
+// NewAccessLog creates an AccessLog, returning an error when a trusted proxy
+// is neither an IP nor a CIDR.
+func NewAccessLog(options AccessLogOptions) (*AccessLog, error) {
+	trustedProxies, err := ParseTrustedProxies(options.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	if options.Logger == nil {
+		options.Logger = log.StandardLogger()
+	}
+	if options.Output == nil {
+		options.Output = os.Stdout
+	}
+	accessLog := &AccessLog{
+		Options:        options,
+		trustedProxies: trustedProxies,
+	}
+	return accessLog, nil
+}
+
+// Middleware logs each request once it has been handled.
+func (accessLog *AccessLog) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		started := time.Now()
+		req = TrackRoutePattern(req)
+		cw := NewCapturingResponseWriter(w)
+		next.ServeHTTP(cw.Writer(), req)
+		accessLog.log(req, cw, started, time.Since(started))
+	})
+}
+
+func (accessLog *AccessLog) log(req *http.Request, cw *CapturingResponseWriter, started time.Time, duration time.Duration) {
+	var userId int64
+	if accessLog.Options.UserIdFunc != nil {
+		var err error
+		if userId, err = accessLog.Options.UserIdFunc(req); err != nil {
+			log.Debugf("web.AccessLog: user ID lookup failed: %s", err)
+		}
+	}
+	requestId := RequestId(req)
+	if len(requestId) == 0 {
+		// NB: Set by `RequestIdMiddleware' when it is nested inside this one.
+		requestId = cw.Header().Get(RequestIdHeader)
+	}
+	if len(requestId) == 0 {
+		requestId = req.Header.Get(RequestIdHeader)
+	}
+	remoteIp := ClientIp(req, accessLog.trustedProxies)
+
+	switch accessLog.Options.Format {
+	case AccessLogCombined:
+		user := "-"
+		if userId != 0 {
+			user = fmt.Sprint(userId)
+		}
+		size := "-"
+		if cw.Bytes > 0 {
+			size = fmt.Sprint(cw.Bytes)
+		}
+		line := fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s %q %q\n",
+			remoteIp,
+			user,
+			started.Format("02/Jan/2006:15:04:05 -0700"),
+			req.Method,
+			req.RequestURI,
+			req.Proto,
+			cw.StatusCode,
+			size,
+			req.Referer(),
+			req.UserAgent(),
+		)
+		accessLog.write([]byte(line))
+
+	default:
+		fields := log.Fields{
+			"method":      req.Method,
+			"uri":         req.RequestURI,
+			"route":       RoutePattern(req),
+			"proto":       req.Proto,
+			"status":      cw.StatusCode,
+			"bytes":       cw.Bytes,
+			"duration_ms": float64(duration) / float64(time.Millisecond),
+			"remote_ip":   remoteIp,
+			"referer":     req.Referer(),
+			"user_agent":  req.UserAgent(),
+		}
+		if userId != 0 {
+			fields["user_id"] = userId
+		}
+		if len(requestId) > 0 {
+			fields["request_id"] = requestId
+		}
+		if accessLog.Options.Format == AccessLogLogrus {
+			accessLog.Options.Logger.WithFields(fields).Info("request")
+			return
+		}
+		fields["time"] = started.Format(time.RFC3339Nano)
+		line, err := json.Marshal(fields)
+		if err != nil {
+			log.Errorf("web.AccessLog: marshalling entry: %s", err)
+			return
+		}
+		accessLog.write(append(line, '\n'))
+	}
+}
+
+func (accessLog *AccessLog) write(line []byte) {
+	accessLog.lock.Lock()
+	defer accessLog.lock.Unlock()
+	if _, err := accessLog.Options.Output.Write(line); err != nil {
+		log.Errorf("web.AccessLog: writing entry: %s", err)
+	}
+}
+
+// ParseTrustedProxies parses a list of IPs and CIDRs.
+func ParseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: not an IP or CIDR", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %s", proxy, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// ClientIp determines the IP of the client which made req.  When the peer is a
+// trusted proxy, X-Forwarded-For is walked from the right to find the first
+// untrusted address, falling back to X-Real-IP.
+func ClientIp(req *http.Request, trustedProxies []*net.IPNet) string {
+	remoteIp := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		remoteIp = host
+	}
+	if !isTrustedProxy(remoteIp, trustedProxies) {
+		return remoteIp
+	}
+
+	// NB: Multiple X-Forwarded-For headers are equivalent to a single joined one.
+	if forwardedFor := strings.Join(req.Header["X-Forwarded-For"], ","); len(forwardedFor) > 0 {
+		hops := strings.Split(forwardedFor, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if i == 0 || !isTrustedProxy(hop, trustedProxies) {
+				return hop
+			}
+		}
+	}
+	if realIp := strings.TrimSpace(req.Header.Get("X-Real-IP")); len(realIp) > 0 {
+		return realIp
+	}
+	return remoteIp
+}
+
+func isTrustedProxy(addr string, trustedProxies []*net.IPNet) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
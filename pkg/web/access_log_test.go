@@ -0,0 +1,116 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func accessLogTestHandler() http.Handler {
+	return WithRoutePattern("/items/:id", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set(RequestIdHeader, "req-1")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, "created")
+	}))
+}
+
+func TestAccessLogJson(t *testing.T) {
+	buf := &bytes.Buffer{}
+	accessLog, err := NewAccessLog(AccessLogOptions{
+		Format:         AccessLogJson,
+		Output:         buf,
+		TrustedProxies: []string{"10.0.0.0/8"},
+		UserIdFunc:     func(_ *http.Request) (int64, error) { return 99, nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("POST", "/items/7?x=y", nil)
+	req.RemoteAddr = "10.1.2.3:5555"
+	req.Header.Set("X-Forwarded-For", "203.0.113.9, 10.0.0.1")
+	accessLog.Middleware(accessLogTestHandler()).ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected a JSON line but got %q: %s", buf.String(), err)
+	}
+	expected := map[string]interface{}{
+		"method":     "POST",
+		"uri":        "/items/7?x=y",
+		"route":      "/items/:id",
+		"status":     float64(http.StatusCreated),
+		"bytes":      float64(len("created")),
+		"remote_ip":  "203.0.113.9",
+		"user_id":    float64(99),
+		"request_id": "req-1",
+	}
+	for key, value := range expected {
+		if actual := entry[key]; actual != value {
+			t.Errorf("Expected entry[%q]=%v but actual=%v", key, value, actual)
+		}
+	}
+	for _, key := range []string{"time", "duration_ms"} {
+		if _, ok := entry[key]; !ok {
+			t.Errorf("Expected entry to contain key=%q", key)
+		}
+	}
+}
+
+func TestAccessLogCombined(t *testing.T) {
+	buf := &bytes.Buffer{}
+	accessLog, err := NewAccessLog(AccessLogOptions{Format: AccessLogCombined, Output: buf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/items/7", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.9") // Not honoured from an untrusted peer.
+	req.Header.Set("User-Agent", "test-agent")
+	accessLog.Middleware(accessLogTestHandler()).ServeHTTP(httptest.NewRecorder(), req)
+
+	expr := regexp.MustCompile(`^192\.0\.2\.1 - - \[[^\]]+\] "GET /items/7 HTTP/1\.1" 201 7 "" "test-agent"\n$`)
+	if !expr.Match(buf.Bytes()) {
+		t.Errorf("Expected combined log line to match %v but actual=%q", expr, buf.String())
+	}
+}
+
+func TestClientIp(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"127.0.0.1", "10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		remoteAddr    string
+		forwardedFor  string
+		realIp        string
+		expectedOutput string
+	}{
+		{"192.0.2.1:1", "", "", "192.0.2.1"},
+		{"192.0.2.1:1", "203.0.113.9", "", "192.0.2.1"},
+		{"127.0.0.1:1", "203.0.113.9", "", "203.0.113.9"},
+		{"127.0.0.1:1", "198.51.100.1, 203.0.113.9, 10.0.0.2", "", "203.0.113.9"},
+		{"127.0.0.1:1", "10.0.0.3, 10.0.0.2", "", "10.0.0.3"},
+		{"127.0.0.1:1", "", "203.0.113.9", "203.0.113.9"},
+	}
+	for i, testCase := range testCases {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = testCase.remoteAddr
+		if len(testCase.forwardedFor) > 0 {
+			req.Header.Set("X-Forwarded-For", testCase.forwardedFor)
+		}
+		if len(testCase.realIp) > 0 {
+			req.Header.Set("X-Real-IP", testCase.realIp)
+		}
+		if expected, actual := testCase.expectedOutput, ClientIp(req, trusted); actual != expected {
+			t.Errorf("[i=%v] Expected client IP=%v but actual=%v", i, expected, actual)
+		}
+	}
+
+	if _, err := ParseTrustedProxies([]string{"not-an-ip"}); err == nil {
+		t.Error("Expected an invalid trusted proxy to produce an error")
+	}
+}
@@ -4,23 +4,76 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+
+	"github.com/gigawattio/go-commons/pkg/validation"
+)
+
+// BindError indicates the request body couldn't be deserialized, and is
+// mapped to 400 Bad Request by `ErrorStatus()'.
+type BindError struct {
+	Err error
+}
+
+func (be *BindError) Error() string {
+	return be.Err.Error()
+}
+
+var (
+	// MaxMultipartMemory is how much of a multipart body `Bind()' holds in
+	// memory, the remainder of file parts is stored in temporary files.
+	MaxMultipartMemory int64 = 32 << 20
+
+	// MaxMultipartSize limits the size of multipart bodies accepted by
+	// `Bind()', unlimited if 0.
+	MaxMultipartSize int64 = 64 << 20
 )
 
-// Bind automatically deserializes the request body into the specified value.
+// Bind automatically deserializes the request into the specified value.
 //
 // `value` must be a pointer to the value to be deserialized.
 //
-// The decoder is automatically selected based on the "Content-Type" header in
-// the request.
+// The body decoder is automatically selected based on the "Content-Type"
+// header in the request.  Afterwards struct fields tagged with `query:"name"'
+// are set from the query string, and those tagged with `path:"name"' from the
+// route's path parameters (e.g. "/users/:id"), so these take precedence over
+// values in the body.  Requests without a body or "Content-Type" are only bound
+// from the query string and path.
 //
 // Currently supported content types are:
 //     - JSON
 //     - XML
 //     - YAML
+//     - URL-encoded forms, into fields tagged `form:"name"'.
+//     - Multipart forms, into fields tagged `form:"name"'.  File parts are
+//       bound to *multipart.FileHeader or []*multipart.FileHeader fields, and
+//       their size can be limited with a "maxsize" option, e.g.
+//       `form:"avatar,maxsize=1048576"'.  The whole body is limited to
+//       `MaxMultipartSize'.
+//
+// Path, query and form values are converted to the field's type, which may be
+// a string, bool, int, uint, float, time.Time (RFC 3339 or "2006-01-02"),
+// time.Duration or implementation of encoding.TextUnmarshaler, or a slice of
+// or pointer to one of those.
 func Bind(req *http.Request, value interface{}) (err error) {
+	if err = bindBody(req, value); err != nil {
+		return
+	}
+	if err = bindValues(value, "query", req.URL.Query(), nil); err != nil {
+		return
+	}
+	err = bindValues(value, "path", pathValues(req), nil)
+	return
+}
+
+// bindBody deserializes the request body into value according to its
+// "Content-Type".
+func bindBody(req *http.Request, value interface{}) (err error) {
 	full := req.Header.Get("Content-Type")
 	// Support impure content-type values such as "application/json; charset=utf-8".
 	contentType := strings.ToLower(strings.TrimSpace(strings.Split(full, ";")[0]))
+	if len(contentType) == 0 && req.ContentLength == 0 {
+		return
+	}
 	switch {
 	case contentType == MimeJson:
 		err = DecodeJson(req.Body, value)
@@ -28,8 +81,38 @@ func Bind(req *http.Request, value interface{}) (err error) {
 		err = DecodeXml(req.Body, value)
 	case contentType == MimeYaml || contentType == MimeYaml2 || contentType == MimeYaml3:
 		err = DecodeYaml(req.Body, value)
+	case contentType == MimePostForm:
+		if err = req.ParseForm(); err != nil {
+			err = fmt.Errorf("bind failed; parsing form: %s", err)
+			return
+		}
+		err = bindValues(value, "form", req.PostForm, nil)
+	case contentType == MimeMultipartForm:
+		if MaxMultipartSize > 0 {
+			req.Body = http.MaxBytesReader(nil, req.Body, MaxMultipartSize)
+		}
+		// NB: net/http removes any temporary files once the handler returns.
+		if err = req.ParseMultipartForm(MaxMultipartMemory); err != nil {
+			err = fmt.Errorf("bind failed; parsing multipart form: %s", err)
+			return
+		}
+		err = bindValues(value, "form", req.MultipartForm.Value, req.MultipartForm.File)
 	default:
 		err = fmt.Errorf("bind failed; unable to handle content-type=%s", contentType)
 	}
 	return
 }
+
+// BindAndValidate deserializes the request into value like `Bind()' and then
+// validates it with `validation.Validate()'.
+//
+// Deserialization failures are returned as a *BindError and invalid values as a
+// *validation.ValidationError listing each invalid field, so when returned
+// from e.g. a `generics.GenericObjectEndpoint()' processor they're rendered
+// as 400 and 422 responses respectively.
+func BindAndValidate(req *http.Request, value interface{}) error {
+	if err := Bind(req, value); err != nil {
+		return &BindError{Err: err}
+	}
+	return validation.Validate(value)
+}
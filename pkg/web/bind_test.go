@@ -3,9 +3,16 @@ package web
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
+	"mime/multipart"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/nbio/hitch"
 )
 
 // Test_BindContentTypeParsing exercises `web.Bind()' for the ability to handle
@@ -69,3 +76,153 @@ raw body content:
 		}
 	}
 }
+
+type bindTarget struct {
+	Id      int64                   `path:"id" json:"id"`
+	Verbose bool                    `query:"verbose" json:"verbose"`
+	Tags    []string                `query:"tag"`
+	Since   *time.Time              `query:"since"`
+	Timeout time.Duration           `query:"timeout"`
+	Name    string                  `form:"name" json:"name"`
+	Ratio   float64                 `form:"ratio"`
+	Count   *uint8                  `form:"count"`
+	Avatar  *multipart.FileHeader   `form:"avatar,maxsize=16"`
+	Photos  []*multipart.FileHeader `form:"photos"`
+}
+
+// serveBind routes req through hitch so path parameters are available.
+func serveBind(req *http.Request) (*bindTarget, error) {
+	var (
+		target = &bindTarget{}
+		err    error
+	)
+	h := hitch.New()
+	h.HandleFunc("POST", "/users/:id", func(w http.ResponseWriter, req *http.Request) {
+		err = Bind(req, target)
+	})
+	h.HandleFunc("GET", "/users/:id", func(w http.ResponseWriter, req *http.Request) {
+		err = Bind(req, target)
+	})
+	h.HandleFunc("PUT", "/users/:id", func(w http.ResponseWriter, req *http.Request) {
+		err = Bind(req, target)
+	})
+	h.Handler().ServeHTTP(httptest.NewRecorder(), req)
+	return target, err
+}
+
+func TestBindPathQueryAndForm(t *testing.T) {
+	form := url.Values{"name": {"jay"}, "ratio": {"0.5"}, "count": {"7"}}
+	req := httptest.NewRequest("POST", "/users/42?verbose=true&tag=a&tag=b&since=2017-03-01&timeout=1m30s", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", MimePostForm+"; charset=utf-8")
+	target, err := serveBind(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := int64(42), target.Id; actual != expected {
+		t.Errorf("Expected Id=%v but actual=%v", expected, actual)
+	}
+	if !target.Verbose {
+		t.Error("Expected Verbose=true")
+	}
+	if expected, actual := "[a b]", fmt.Sprint(target.Tags); actual != expected {
+		t.Errorf("Expected Tags=%v but actual=%v", expected, actual)
+	}
+	if target.Since == nil || !target.Since.Equal(time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected Since=2017-03-01 but actual=%v", target.Since)
+	}
+	if expected, actual := 90*time.Second, target.Timeout; actual != expected {
+		t.Errorf("Expected Timeout=%v but actual=%v", expected, actual)
+	}
+	if expected, actual := "jay", target.Name; actual != expected {
+		t.Errorf("Expected Name=%v but actual=%v", expected, actual)
+	}
+	if expected, actual := 0.5, target.Ratio; actual != expected {
+		t.Errorf("Expected Ratio=%v but actual=%v", expected, actual)
+	}
+	if target.Count == nil || *target.Count != 7 {
+		t.Errorf("Expected Count=7 but actual=%v", target.Count)
+	}
+
+	// No body, so only the path and query string are bound.
+	target, err = serveBind(httptest.NewRequest("GET", "/users/7?verbose=1", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.Id != 7 || !target.Verbose {
+		t.Errorf("Expected Id=7 and Verbose=true but actual=%+v", target)
+	}
+
+	for _, path := range []string{"/users/x", "/users/1?verbose=maybe", "/users/1?since=yesterday", "/users/1?timeout=5"} {
+		if _, err := serveBind(httptest.NewRequest("GET", path, nil)); err == nil {
+			t.Errorf("Expected an error binding path=%v", path)
+		}
+	}
+}
+
+func TestBindPrecedence(t *testing.T) {
+	req := httptest.NewRequest("PUT", "/users/1?verbose=false", strings.NewReader(`{"id": 2, "verbose": true, "name": "jay"}`))
+	req.Header.Set("Content-Type", MimeJson)
+	target, err := serveBind(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := int64(1), target.Id; actual != expected {
+		t.Errorf("Expected path parameter to take precedence with Id=%v but actual=%v", expected, actual)
+	}
+	if target.Verbose {
+		t.Error("Expected query string to take precedence with Verbose=false")
+	}
+	if expected, actual := "jay", target.Name; actual != expected {
+		t.Errorf("Expected Name=%v but actual=%v", expected, actual)
+	}
+}
+
+func TestBindMultipart(t *testing.T) {
+	genRequest := func(avatar string) *http.Request {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		writer.WriteField("name", "jay")
+		part, _ := writer.CreateFormFile("avatar", "avatar.png")
+		part.Write([]byte(avatar))
+		for _, name := range []string{"a.jpg", "b.jpg"} {
+			part, _ = writer.CreateFormFile("photos", name)
+			part.Write([]byte(name))
+		}
+		writer.Close()
+		req := httptest.NewRequest("POST", "/users/1", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		return req
+	}
+
+	target, err := serveBind(genRequest("small"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "jay", target.Name; actual != expected {
+		t.Errorf("Expected Name=%v but actual=%v", expected, actual)
+	}
+	if target.Avatar == nil || target.Avatar.Filename != "avatar.png" {
+		t.Fatalf("Expected Avatar with filename=avatar.png but actual=%+v", target.Avatar)
+	}
+	file, err := target.Avatar.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if data, _ := ioutil.ReadAll(file); string(data) != "small" {
+		t.Errorf("Expected Avatar content=%q but actual=%q", "small", string(data))
+	}
+	if expected, actual := 2, len(target.Photos); actual != expected {
+		t.Errorf("Expected number of Photos=%v but actual=%v", expected, actual)
+	}
+
+	if _, err := serveBind(genRequest("much larger than sixteen bytes")); err == nil {
+		t.Error("Expected an error for an avatar exceeding maxsize")
+	}
+
+	defer func(original int64) { MaxMultipartSize = original }(MaxMultipartSize)
+	MaxMultipartSize = 64
+	if _, err := serveBind(genRequest("small")); err == nil {
+		t.Error("Expected an error for a body exceeding MaxMultipartSize")
+	}
+}
@@ -0,0 +1,200 @@
+package web
+
+import (
+	"encoding"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nbio/hitch"
+)
+
+var (
+	fileHeaderType      = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeaderSliceType = reflect.TypeOf([]*multipart.FileHeader(nil))
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// pathValues returns the route's path parameters.
+func pathValues(req *http.Request) map[string][]string {
+	values := map[string][]string{}
+	for _, param := range hitch.Params(req) {
+		values[param.Key] = []string{param.Value}
+	}
+	return values
+}
+
+// bindValues sets the fields of the struct value points to which are tagged
+// with tagName from values, and file fields from files.  Values which aren't
+// pointers to structs are left alone, as they may be decoded from the body.
+func bindValues(value interface{}, tagName string, values map[string][]string, files map[string][]*multipart.FileHeader) error {
+	if len(values) == 0 && len(files) == 0 {
+		return nil
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	return bindStruct(v.Elem(), tagName, values, files)
+}
+
+func bindStruct(v reflect.Value, tagName string, values map[string][]string, files map[string][]*multipart.FileHeader) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+		field := v.Field(i)
+		tag := structField.Tag.Get(tagName)
+		if len(tag) == 0 && structField.Anonymous && structField.Type.Kind() == reflect.Struct {
+			if err := bindStruct(field, tagName, values, files); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(tag) == 0 || tag == "-" || len(structField.PkgPath) > 0 {
+			continue
+		}
+		var (
+			pieces  = strings.Split(tag, ",")
+			name    = pieces[0]
+			maxSize int64
+		)
+		for _, option := range pieces[1:] {
+			if strings.HasPrefix(option, "maxsize=") {
+				var err error
+				if maxSize, err = strconv.ParseInt(option[len("maxsize="):], 10, 64); err != nil {
+					return fmt.Errorf("bind failed; invalid maxsize option for field %v.%v: %s", t.Name(), structField.Name, err)
+				}
+			}
+		}
+		if structField.Type == fileHeaderType || structField.Type == fileHeaderSliceType {
+			fileHeaders, ok := files[name]
+			if !ok || len(fileHeaders) == 0 {
+				continue
+			}
+			if maxSize > 0 {
+				for _, fileHeader := range fileHeaders {
+					if err := checkFileSize(fileHeader, maxSize); err != nil {
+						return fmt.Errorf("bind failed; %s %q: %s", tagName, name, err)
+					}
+				}
+			}
+			if structField.Type == fileHeaderType {
+				field.Set(reflect.ValueOf(fileHeaders[0]))
+			} else {
+				field.Set(reflect.ValueOf(fileHeaders))
+			}
+			continue
+		}
+		fieldValues, ok := values[name]
+		if !ok || len(fieldValues) == 0 {
+			continue
+		}
+		if err := setField(field, fieldValues); err != nil {
+			return fmt.Errorf("bind failed; %s %q: %s", tagName, name, err)
+		}
+	}
+	return nil
+}
+
+// checkFileSize returns an error if the uploaded file is larger than maxSize
+// bytes.
+func checkFileSize(fileHeader *multipart.FileHeader, maxSize int64) error {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if size > maxSize {
+		return fmt.Errorf("file %q is %v bytes, exceeding the limit of %v bytes", fileHeader.Filename, size, maxSize)
+	}
+	return nil
+}
+
+// setField sets field from values, using all of them for slices and the first
+// otherwise.
+func setField(field reflect.Value, values []string) error {
+	if field.Kind() == reflect.Slice && !field.Addr().Type().Implements(textUnmarshalerType) {
+		slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+		for i, s := range values {
+			if err := setScalar(slice.Index(i), s); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	}
+	return setScalar(field, values[0])
+}
+
+func setScalar(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Ptr {
+		elem := reflect.New(v.Type().Elem())
+		if err := setScalar(elem.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+	switch v.Type() {
+	case timeType:
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02"} {
+			if t, err := time.Parse(layout, s); err == nil {
+				v.Set(reflect.ValueOf(t))
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid time %q, expected RFC 3339 or YYYY-MM-DD", s)
+	case durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	if v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field type %v", v.Type())
+	}
+	return nil
+}
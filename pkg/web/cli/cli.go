@@ -8,8 +8,10 @@ import (
 	"io"
 	"os"
 	"os/signal"
+	"syscall"
 
 	"github.com/gigawattio/go-commons/pkg/upstart"
+	"github.com/gigawattio/go-commons/pkg/web"
 	"github.com/gigawattio/go-commons/pkg/web/interfaces"
 
 	cliv2 "gopkg.in/urfave/cli.v2"
@@ -29,6 +31,9 @@ type Options struct {
 	Stdout             io.Writer
 	Stderr             io.Writer
 	WebServiceProvider interfaces.WebServiceProvider
+	RepositoryProvider interfaces.RepositoryProvider // Optional; enables the `export' and `import' subcommands.
+	Models             []interface{}                 // Models available to `export' and `import'.
+	Stdin              io.Reader
 	Args               []string
 	ExitOnError        bool // Exit on non-nil error during invocation of `Main()`.
 }
@@ -37,6 +42,9 @@ type Options struct {
 type Cli struct {
 	App                *cliv2.App
 	WebServiceProvider interfaces.WebServiceProvider
+	RepositoryProvider interfaces.RepositoryProvider
+	Models             []interface{}
+	Stdin              io.Reader
 	Args               []string
 	Install            bool   // NB: Flag variable.
 	Uninstall          bool   // NB: Flag variable.
@@ -57,6 +65,9 @@ func New(options Options) (*Cli, error) {
 			ErrWriter: options.Stderr,
 		},
 		WebServiceProvider: options.WebServiceProvider,
+		RepositoryProvider: options.RepositoryProvider,
+		Models:             options.Models,
+		Stdin:              options.Stdin,
 		Args:               options.Args,
 		ExitOnError:        options.ExitOnError,
 	}
@@ -94,6 +105,9 @@ func (cli *Cli) Init() error {
 	if cli.Args == nil {
 		cli.Args = os.Args
 	}
+	if cli.Stdin == nil {
+		cli.Stdin = os.Stdin
+	}
 	if cli.App.ErrWriter == nil {
 		cli.App.Writer = os.Stdout
 	}
@@ -137,6 +151,11 @@ func (cli *Cli) Init() error {
 	// Setup default action
 	cli.App.Action = cli.DefaultAction
 
+	// Data management subcommands.
+	if cli.RepositoryProvider != nil {
+		cli.App.Commands = append(cli.App.Commands, cli.dataCommands()...)
+	}
+
 	cli.initialized = true // Mark as initialized.
 
 	return nil
@@ -185,16 +204,32 @@ func (cli *Cli) RunWeb(ctx *cliv2.Context) error {
 	if webService == nil {
 		return NilWebServiceError
 	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM, web.HotRestartSignal)
+	defer signal.Stop(sig)
+
 	if err := webService.Start(); err != nil {
 		return err
 	}
 	fmt.Fprintf(cli.App.Writer, "Successfully started web service on addr=%v\n", webService.Addr())
 
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, os.Interrupt)
+	// When this process was started by a hot restart, the parent can now exit.
+	if err := web.NotifyHotRestartReady(); err != nil {
+		fmt.Fprintf(cli.App.ErrWriter, "Failed to notify hot restart parent process: %s\n", err)
+	}
 
-	<-sig // Wait for ^C signal.
-	fmt.Fprintln(cli.App.ErrWriter, "\nInterrupt signal detected, shutting down..")
+	for s := range sig {
+		if s == web.HotRestartSignal {
+			cli.hotRestart(webService)
+			continue
+		}
+		if s == os.Interrupt {
+			fmt.Fprintln(cli.App.ErrWriter, "\nInterrupt signal detected, shutting down..")
+		} else {
+			fmt.Fprintln(cli.App.ErrWriter, "\nTermination signal detected, shutting down..")
+		}
+		break
+	}
 
 	if err := webService.Stop(); err != nil {
 		return err
@@ -203,6 +238,31 @@ func (cli *Cli) RunWeb(ctx *cliv2.Context) error {
 	return nil
 }
 
+// hotRestart starts a new process to take over serving from webService.  Once
+// the new process is up it sends SIGTERM, upon which this process gracefully
+// shuts down.
+func (cli *Cli) hotRestart(webService interfaces.WebService) {
+	restarter, ok := webService.(interfaces.HotRestarter)
+	if !ok {
+		fmt.Fprintln(cli.App.ErrWriter, "Hot restart requested but not supported by the web service, ignoring")
+		return
+	}
+	process, err := restarter.HotRestart()
+	if err != nil {
+		fmt.Fprintf(cli.App.ErrWriter, "Hot restart failed: %s\n", err)
+		return
+	}
+	fmt.Fprintf(cli.App.Writer, "Hot restart: started new process pid=%v, waiting for it to take over..\n", process.Pid)
+	go func() {
+		// Reap the child; if it exits early this process continues serving.
+		if state, err := process.Wait(); err != nil {
+			fmt.Fprintf(cli.App.ErrWriter, "Hot restart: waiting for pid=%v: %s\n", process.Pid, err)
+		} else if !state.Success() {
+			fmt.Fprintf(cli.App.ErrWriter, "Hot restart: new process pid=%v exited with %v\n", process.Pid, state)
+		}
+	}()
+}
+
 func (cli *Cli) Main() error {
 	// Temporarily disable cliv2 os exiter and redirect ErrWriter to the one for
 	// this app.
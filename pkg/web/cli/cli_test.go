@@ -3,12 +3,17 @@ package cli
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/gigawattio/go-commons/pkg/driver/repository"
 	"github.com/gigawattio/go-commons/pkg/errorlib"
 	"github.com/gigawattio/go-commons/pkg/testlib"
 	service "github.com/gigawattio/go-commons/pkg/web/cli/example/service"
@@ -19,7 +24,11 @@ import (
 )
 
 func simpleWebServiceProvider(ctx *cliv2.Context) (interfaces.WebService, error) {
-	return service.New(ctx.String("bind")), nil
+	webService, err := service.New(ctx.String("bind"))
+	if err != nil {
+		return nil, err
+	}
+	return webService, nil
 }
 
 // genTestCliArgs prepends the current running tests name to the slice (in lieu
@@ -71,7 +80,10 @@ func TestCli(t *testing.T) {
 func TestCliBindFlagWhenDefaultPortIsInUse(t *testing.T) {
 	// Start on the default bind address:port.
 	{
-		defaultWebService := service.New(DefaultBindAddr)
+		defaultWebService, err := service.New(DefaultBindAddr)
+		if err != nil {
+			t.Fatal(err)
+		}
 		if err := defaultWebService.Start(); err != nil {
 			t.Fatal(err)
 		}
@@ -230,3 +242,157 @@ func TestCliOutputOverrides(t *testing.T) {
 		t.Errorf("Expected c.App.ErrWriter == fakeStderr (*bytes.Buffer) but it was set to something else instead; actual value=%T/%p", c.App.ErrWriter, c.App.ErrWriter)
 	}
 }
+
+type cliModel struct {
+	Id int64
+}
+
+type otherCliModel struct {
+	Id int64
+}
+
+// fakeRepository records Export and Import invocations.  Invoking any other
+// RepositoryDriver method will panic.
+type fakeRepository struct {
+	repository.RepositoryDriver
+	selections []repository.ExportSelection
+	imported   string
+	models     []interface{}
+	closed     bool
+}
+
+func (fake *fakeRepository) Export(w io.Writer, selections ...repository.ExportSelection) (int64, error) {
+	fake.selections = selections
+	io.WriteString(w, "{\"table\":\"cli_models\",\"record\":{\"id\":1}}\n")
+	return int64(len(selections)), nil
+}
+
+func (fake *fakeRepository) Import(r io.Reader, models ...interface{}) (int64, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	fake.imported = string(data)
+	fake.models = models
+	return int64(strings.Count(fake.imported, "\n")), nil
+}
+
+func (fake *fakeRepository) TableName(model interface{}) string {
+	switch model.(type) {
+	case *cliModel:
+		return "cli_models"
+	case *otherCliModel:
+		return "other_cli_models"
+	}
+	return ""
+}
+
+func (fake *fakeRepository) Close() error {
+	fake.closed = true
+	return nil
+}
+
+func newDataCli(t *testing.T, fake *fakeRepository, stdin io.Reader, stdout io.Writer, args ...string) *Cli {
+	options := Options{
+		AppName:            testlib.CurrentRunningTest(),
+		Args:               genTestCliArgs(args...),
+		WebServiceProvider: simpleWebServiceProvider,
+		RepositoryProvider: func(ctx *cliv2.Context) (repository.RepositoryDriver, error) { return fake, nil },
+		Models:             []interface{}{&cliModel{}, &otherCliModel{}},
+		Stdin:              stdin,
+		Stdout:             stdout,
+		Stderr:             &bytes.Buffer{},
+	}
+	c, err := New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCliExport(t *testing.T) {
+	var (
+		fake   = &fakeRepository{}
+		stdout = &bytes.Buffer{}
+		c      = newDataCli(t, fake, nil, stdout, "export", "--where", "id = 1", "other_cli_models")
+	)
+	if err := c.Main(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []repository.ExportSelection{{Model: &otherCliModel{}, Query: "id = 1"}}
+	if !reflect.DeepEqual(fake.selections, expected) {
+		t.Errorf("Expected selections=%+v but actual=%+v", expected, fake.selections)
+	}
+	if expected, actual := "{\"table\":\"cli_models\",\"record\":{\"id\":1}}\n", stdout.String(); actual != expected {
+		t.Errorf("Expected stdout=%q but actual=%q", expected, actual)
+	}
+	if !fake.closed {
+		t.Error("Expected repository to be closed")
+	}
+
+	// All known tables are exported when none are named.
+	fake = &fakeRepository{}
+	if err := newDataCli(t, fake, nil, &bytes.Buffer{}, "export").Main(); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 2, len(fake.selections); actual != expected {
+		t.Errorf("Expected num selections=%v but actual=%v", expected, actual)
+	}
+
+	if err := newDataCli(t, &fakeRepository{}, nil, &bytes.Buffer{}, "export", "unknown_table").Main(); err == nil {
+		t.Error("Expected exporting an unknown table to fail")
+	}
+
+	fake = &fakeRepository{}
+	if err := newDataCli(t, fake, nil, &bytes.Buffer{}, "export", "--where", "id = 1").Main(); err != WhereRequiresTablesError {
+		t.Errorf("Expected error=%v but actual=%v", WhereRequiresTablesError, err)
+	}
+	if fake.selections != nil {
+		t.Errorf("Expected nothing to be exported but selections=%+v", fake.selections)
+	}
+}
+
+func TestCliExportImportFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli-data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "export.jsonl")
+
+	if err := newDataCli(t, &fakeRepository{}, nil, &bytes.Buffer{}, "export", "--output", path).Main(); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeRepository{}
+	if err := newDataCli(t, fake, strings.NewReader("unused"), &bytes.Buffer{}, "import", "-i", path).Main(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "{\"table\":\"cli_models\",\"record\":{\"id\":1}}\n"; fake.imported != expected {
+		t.Errorf("Expected imported=%q but actual=%q", expected, fake.imported)
+	}
+}
+
+func TestCliImport(t *testing.T) {
+	var (
+		fake   = &fakeRepository{}
+		input  = "{\"table\":\"cli_models\",\"record\":{\"id\":1}}\n{\"table\":\"cli_models\",\"record\":{\"id\":2}}\n"
+		stdout = &bytes.Buffer{}
+		c      = newDataCli(t, fake, strings.NewReader(input), stdout, "import")
+	)
+	if err := c.Main(); err != nil {
+		t.Fatal(err)
+	}
+	if fake.imported != input {
+		t.Errorf("Expected imported=%q but actual=%q", input, fake.imported)
+	}
+	if expected, actual := 2, len(fake.models); actual != expected {
+		t.Errorf("Expected num models=%v but actual=%v", expected, actual)
+	}
+	if expected, actual := "Imported 2 records\n", stdout.String(); actual != expected {
+		t.Errorf("Expected stdout=%q but actual=%q", expected, actual)
+	}
+	if !fake.closed {
+		t.Error("Expected repository to be closed")
+	}
+}
@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/gigawattio/go-commons/pkg/driver/repository"
+
+	cliv2 "gopkg.in/urfave/cli.v2"
+)
+
+// dataCommands returns the `export' and `import' subcommands.
+func (cli *Cli) dataCommands() []*cliv2.Command {
+	commands := []*cliv2.Command{
+		&cliv2.Command{
+			Name:      "export",
+			Usage:     "Export records (and everything they're associated with) as JSON Lines",
+			ArgsUsage: "[table...]",
+			Description: "Exports all records from the named tables, or from every known table when\n" +
+				"   none are given.  Use --where to narrow down the records selected, in which\n" +
+				"   case the tables must be named and the condition valid for each of them.",
+			Flags: []cliv2.Flag{
+				&cliv2.StringFlag{
+					Name:    "output",
+					Aliases: []string{"o"},
+					Usage:   "File to write the export to, or - for stdout",
+					Value:   "-",
+				},
+				&cliv2.StringFlag{
+					Name:    "where",
+					Aliases: []string{"w"},
+					Usage:   "SQL condition used to select records from the named tables, e.g. \"id = 1\"",
+				},
+			},
+			Action: cli.Export,
+		},
+		&cliv2.Command{
+			Name:  "import",
+			Usage: "Import records from an export; safe to run repeatedly",
+			Flags: []cliv2.Flag{
+				&cliv2.StringFlag{
+					Name:    "input",
+					Aliases: []string{"i"},
+					Usage:   "File to read the export from, or - for stdin",
+					Value:   "-",
+				},
+			},
+			Action: cli.Import,
+		},
+	}
+	return commands
+}
+
+// Export is the action for the `export' subcommand.
+func (cli *Cli) Export(ctx *cliv2.Context) error {
+	tables := ctx.Args().Slice()
+	if len(ctx.String("where")) > 0 && len(tables) == 0 {
+		// NB: A condition is unlikely to be valid for every known table.
+		return WhereRequiresTablesError
+	}
+	selections := make([]repository.ExportSelection, 0, len(cli.Models))
+	err := cli.withRepository(ctx, func(driver repository.RepositoryDriver) error {
+		models := map[string]interface{}{}
+		for _, model := range cli.Models {
+			models[driver.TableName(model)] = model
+		}
+		if len(tables) == 0 {
+			for _, model := range cli.Models {
+				tables = append(tables, driver.TableName(model))
+			}
+		}
+		for _, table := range tables {
+			model, ok := models[table]
+			if !ok {
+				return fmt.Errorf("unknown table %q", table)
+			}
+			selection := repository.ExportSelection{
+				Model: model,
+			}
+			if where := ctx.String("where"); len(where) > 0 {
+				selection.Query = where
+			}
+			selections = append(selections, selection)
+		}
+
+		w := cli.App.Writer
+		if output := ctx.String("output"); output != "-" && len(output) > 0 {
+			f, err := os.Create(output)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		count, err := driver.Export(w, selections...)
+		if err != nil {
+			return err
+		}
+		// NB: Stdout may contain the export itself.
+		fmt.Fprintf(cli.App.ErrWriter, "Exported %v records\n", count)
+		return nil
+	})
+	return err
+}
+
+// Import is the action for the `import' subcommand.
+func (cli *Cli) Import(ctx *cliv2.Context) error {
+	err := cli.withRepository(ctx, func(driver repository.RepositoryDriver) error {
+		var r io.Reader = cli.Stdin
+		if input := ctx.String("input"); input != "-" && len(input) > 0 {
+			f, err := os.Open(input)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+		count, err := driver.Import(r, cli.Models...)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cli.App.Writer, "Imported %v records\n", count)
+		return nil
+	})
+	return err
+}
+
+func (cli *Cli) withRepository(ctx *cliv2.Context, fn func(driver repository.RepositoryDriver) error) error {
+	if cli.RepositoryProvider == nil {
+		return RepositoryProviderRequiredError
+	}
+	driver, err := cli.RepositoryProvider(ctx)
+	if err != nil {
+		return err
+	}
+	if driver == nil {
+		return NilRepositoryError
+	}
+	defer driver.Close()
+	return fn(driver)
+}
@@ -8,4 +8,7 @@ var (
 	AppNameRequiredError            = errors.New("AppName must not be empty")
 	WebServiceProviderRequiredError = errors.New("WebServiceProvider must not be nil")
 	NilWebServiceError              = errors.New("WebServiceProvider produced a nil WebService without any error")
+	RepositoryProviderRequiredError = errors.New("RepositoryProvider must not be nil")
+	NilRepositoryError              = errors.New("RepositoryProvider produced a nil RepositoryDriver without any error")
+	WhereRequiresTablesError        = errors.New("--where requires the tables to export to be named")
 )
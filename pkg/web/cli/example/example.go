@@ -9,7 +9,10 @@ import (
 )
 
 func webServiceProvider(ctx *cliv2.Context) (interfaces.WebService, error) {
-	webService := service.New(ctx.String("bind"))
+	webService, err := service.New(ctx.String("bind"))
+	if err != nil {
+		return nil, err
+	}
 	return webService, nil
 }
 
@@ -13,29 +13,36 @@ type MyWebService struct {
 	*web.WebServer
 }
 
-func New(bind string) *MyWebService {
+func New(bind string) (*MyWebService, error) {
 	service := &MyWebService{}
+	handler, err := service.activateRoutes()
+	if err != nil {
+		return nil, err
+	}
 	options := web.WebServerOptions{
 		Addr:    bind,
-		Handler: service.activateRoutes(),
+		Handler: handler,
 	}
 	service.WebServer = web.NewWebServer(options)
-	return service
+	return service, nil
 }
 
-func (mws *MyWebService) activateRoutes() http.Handler {
-	h := route.Activate(
+func (mws *MyWebService) activateRoutes() (http.Handler, error) {
+	h, err := route.Activate(
 		[]route.RouteMiddlewareBundle{
 			route.RouteMiddlewareBundle{
 				RouteData: []route.RouteDatum{
-					{"get", "/", func(w http.ResponseWriter, r *http.Request) {
+					{Reciever: "get", Path: "/", HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
 						fmt.Fprint(w, "hello world")
 					}},
 				},
 			},
 		},
-	).Handler()
-	return h
+	)
+	if err != nil {
+		return nil, err
+	}
+	return h.Handler(), nil
 }
 
 func (service *MyWebService) LoggerMiddleware(next http.Handler) http.Handler {
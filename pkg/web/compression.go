@@ -0,0 +1,255 @@
+package web
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	// DefaultCompressionMinSize is the smallest response body worth
+	// compressing.
+	DefaultCompressionMinSize = 1024
+
+	// DefaultCompressionSkipTypes are content type prefixes of formats which
+	// are already compressed.
+	DefaultCompressionSkipTypes = []string{
+		"image/",
+		"video/",
+		"audio/",
+		"font/woff",
+		"application/zip",
+		"application/gzip",
+		"application/x-gzip",
+		"application/x-bzip2",
+		"application/x-xz",
+		"application/x-7z-compressed",
+		"application/x-rar-compressed",
+		"application/pdf",
+		"application/octet-stream",
+	}
+)
+
+// InvalidCompressionLevelError is returned by `CompressionMiddleware()' when
+// the level isn't a valid gzip/flate compression level.
+var InvalidCompressionLevelError = errors.New("invalid compression level")
+
+type CompressionOptions struct {
+	Level     int      // compression level from 1 (fastest) to 9 (smallest) or gzip.HuffmanOnly, gzip.DefaultCompression if 0 (so gzip.NoCompression can't be chosen).
+	MinSize   int      // bodies smaller than this are sent uncompressed, DefaultCompressionMinSize if 0.
+	SkipTypes []string // content type prefixes which are sent uncompressed, DefaultCompressionSkipTypes if nil.
+}
+
+// CompressionMiddleware compresses response bodies with gzip or deflate,
+// according to the request's Accept-Encoding.  Bodies are buffered up to
+// `MinSize' bytes to decide whether compression is worthwhile; calling `Flush()'
+// ends the buffering so streaming responses are delivered promptly.
+//
+// InvalidCompressionLevelError is returned when options.Level is out of range.
+func CompressionMiddleware(options CompressionOptions) (MiddlewareFunc, error) {
+	if options.Level == 0 {
+		options.Level = gzip.DefaultCompression
+	}
+	if options.Level < gzip.HuffmanOnly || options.Level > gzip.BestCompression {
+		return nil, InvalidCompressionLevelError
+	}
+	if options.MinSize == 0 {
+		options.MinSize = DefaultCompressionMinSize
+	}
+	if options.SkipTypes == nil {
+		options.SkipTypes = DefaultCompressionSkipTypes
+	}
+	middleware := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			encoding := NegotiateEncoding(req.Header.Get("Accept-Encoding"))
+			if len(encoding) == 0 || req.Method == "HEAD" {
+				next.ServeHTTP(w, req)
+				return
+			}
+			cw := &compressingResponseWriter{
+				ResponseWriter: w,
+				options:        &options,
+				encoding:       encoding,
+			}
+			defer cw.close()
+			next.ServeHTTP(exposeOptionalInterfaces(cw, w, responseWriterHooks{flush: cw.flush, hijack: cw.hijack}), req)
+		})
+	}
+	return middleware, nil
+}
+
+// NegotiateEncoding picks "gzip" or "deflate" from an Accept-Encoding header
+// value, honouring q-values and preferring gzip.  The empty string is returned
+// when neither is acceptable.
+func NegotiateEncoding(acceptEncoding string) string {
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		if len(coding) == 0 {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if parsed, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		qualities[coding] = q
+	}
+	var (
+		best  string
+		bestQ float64
+	)
+	for _, coding := range []string{"gzip", "deflate"} {
+		q, ok := qualities[coding]
+		if !ok {
+			q, ok = qualities["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+// compressingResponseWriter buffers the start of the body until it can decide
+// whether to compress.
+type compressingResponseWriter struct {
+	http.ResponseWriter
+	options    *CompressionOptions
+	encoding   string
+	statusCode int
+	buf        []byte
+	decided    bool
+	compressor io.WriteCloser // nil when passing through.
+	hijacked   bool
+}
+
+func (cw *compressingResponseWriter) WriteHeader(statusCode int) {
+	if cw.decided || cw.statusCode != 0 {
+		return
+	}
+	cw.statusCode = statusCode
+	// Bodiless responses can't be compressed, so there is nothing to wait for.
+	if statusCode < 200 || statusCode == http.StatusNoContent || statusCode == http.StatusNotModified {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressingResponseWriter) Write(b []byte) (int, error) {
+	if cw.statusCode == 0 {
+		cw.statusCode = http.StatusOK
+	}
+	if !cw.decided {
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) < cw.options.MinSize {
+			return len(b), nil
+		}
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if cw.compressor != nil {
+		return cw.compressor.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// decide sends the headers and buffered body, compressed if worthwhile.
+func (cw *compressingResponseWriter) decide(bigEnough bool) error {
+	cw.decided = true
+	if cw.statusCode == 0 {
+		cw.statusCode = http.StatusOK
+	}
+	header := cw.Header()
+	if len(header.Get("Content-Type")) == 0 && len(cw.buf) > 0 {
+		// NB: net/http would otherwise sniff the compressed bytes.
+		header.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	if bigEnough && cw.compressible() {
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+		if cw.encoding == "gzip" {
+			cw.compressor, _ = gzip.NewWriterLevel(cw.ResponseWriter, cw.options.Level)
+		} else {
+			cw.compressor, _ = flate.NewWriter(cw.ResponseWriter, cw.options.Level)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(cw.statusCode)
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.compressor != nil {
+		_, err = cw.compressor.Write(cw.buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf)
+	}
+	cw.buf = nil
+	return err
+}
+
+func (cw *compressingResponseWriter) compressible() bool {
+	header := cw.Header()
+	if len(header.Get("Content-Encoding")) > 0 || len(header.Get("Content-Range")) > 0 {
+		return false
+	}
+	if cw.statusCode < 200 || cw.statusCode == http.StatusNoContent || cw.statusCode == http.StatusNotModified || cw.statusCode == http.StatusPartialContent {
+		return false
+	}
+	contentType := strings.ToLower(header.Get("Content-Type"))
+	for _, skip := range cw.options.SkipTypes {
+		if strings.HasPrefix(contentType, skip) {
+			return false
+		}
+	}
+	return true
+}
+
+// flush sends any buffered data immediately, compressing it when the response
+// is compressible regardless of its size.
+func (cw *compressingResponseWriter) flush() {
+	if !cw.decided {
+		cw.decide(true)
+	}
+	if flusher, ok := cw.compressor.(interface {
+		Flush() error
+	}); ok {
+		flusher.Flush()
+	}
+	cw.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (cw *compressingResponseWriter) close() {
+	if cw.hijacked {
+		return
+	}
+	if !cw.decided {
+		if cw.statusCode == 0 && len(cw.buf) == 0 {
+			// Nothing was written, leave it to net/http.
+			return
+		}
+		cw.decide(false)
+	}
+	if cw.compressor != nil {
+		cw.compressor.Close()
+	}
+}
+
+// hijack takes over the connection, after which nothing more may be written.
+func (cw *compressingResponseWriter) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	cw.hijacked = true
+	return cw.ResponseWriter.(http.Hijacker).Hijack()
+}
@@ -0,0 +1,178 @@
+package web
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	testCases := map[string]string{
+		"":                            "",
+		"gzip":                        "gzip",
+		"deflate, gzip":               "gzip",
+		"deflate":                     "deflate",
+		"gzip;q=0.5, deflate":         "deflate",
+		"gzip;q=0":                    "",
+		"*":                           "gzip",
+		"br, identity":                "",
+		"GZIP ; q=1.0, deflate;q=0.9": "gzip",
+	}
+	for acceptEncoding, expected := range testCases {
+		if actual := NegotiateEncoding(acceptEncoding); actual != expected {
+			t.Errorf("Expected NegotiateEncoding(%q)=%q but actual=%q", acceptEncoding, expected, actual)
+		}
+	}
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	large := strings.Repeat(`{"name":"value"},`, 200)
+	middleware, err := CompressionMiddleware(CompressionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(acceptEncoding string, contentType string, body string) *httptest.ResponseRecorder {
+		handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if len(contentType) > 0 {
+				w.Header().Set("Content-Type", contentType)
+			}
+			io.WriteString(w, body[:len(body)/2])
+			io.WriteString(w, body[len(body)/2:])
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// gzip.
+	w := serve("gzip, deflate", MimeJson, large)
+	if expected, actual := "gzip", w.Header().Get("Content-Encoding"); actual != expected {
+		t.Fatalf("Expected Content-Encoding=%q but actual=%q", expected, actual)
+	}
+	if expected, actual := "Accept-Encoding", w.Header().Get("Vary"); actual != expected {
+		t.Errorf("Expected Vary=%q but actual=%q", expected, actual)
+	}
+	reader, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decompressed, err := ioutil.ReadAll(reader); err != nil {
+		t.Fatal(err)
+	} else if string(decompressed) != large {
+		t.Error("Expected decompressed gzip body to match the original")
+	}
+
+	// deflate.
+	w = serve("deflate", "", large)
+	if expected, actual := "deflate", w.Header().Get("Content-Encoding"); actual != expected {
+		t.Fatalf("Expected Content-Encoding=%q but actual=%q", expected, actual)
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("Expected Content-Type to be sniffed from the uncompressed body but actual=%q", w.Header().Get("Content-Type"))
+	}
+	if decompressed, err := ioutil.ReadAll(flate.NewReader(w.Body)); err != nil {
+		t.Fatal(err)
+	} else if string(decompressed) != large {
+		t.Error("Expected decompressed deflate body to match the original")
+	}
+
+	// Skipped.
+	for _, testCase := range []struct {
+		acceptEncoding string
+		contentType    string
+		body           string
+	}{
+		{"gzip", MimeJson, `{"small":true}`},
+		{"gzip", "image/png", large},
+		{"identity", MimeJson, large},
+	} {
+		w := serve(testCase.acceptEncoding, testCase.contentType, testCase.body)
+		if actual := w.Header().Get("Content-Encoding"); len(actual) > 0 {
+			t.Errorf("Expected no Content-Encoding for %+v but actual=%q", testCase, actual)
+		}
+		if actual := w.Body.String(); actual != testCase.body {
+			t.Errorf("Expected uncompressed body for %+v", testCase)
+		}
+	}
+}
+
+func TestCompressionMiddlewareInvalidLevel(t *testing.T) {
+	for _, level := range []int{-3, 10} {
+		if _, err := CompressionMiddleware(CompressionOptions{Level: level}); err != InvalidCompressionLevelError {
+			t.Errorf("Expected err=%v for level=%v but actual=%v", InvalidCompressionLevelError, level, err)
+		}
+	}
+	// Valid levels, including gzip.HuffmanOnly.
+	for _, level := range []int{gzip.HuffmanOnly, gzip.DefaultCompression, gzip.BestSpeed, gzip.BestCompression} {
+		if _, err := CompressionMiddleware(CompressionOptions{Level: level}); err != nil {
+			t.Errorf("Expected no error for level=%v but actual=%v", level, err)
+		}
+	}
+}
+
+func TestCompressionMiddlewareStreaming(t *testing.T) {
+	chunks := make(chan string)
+	compression, err := CompressionMiddleware(CompressionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewWebServer(WebServerOptions{
+		Addr: testAddr,
+		Handler: compression(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for chunk := range chunks {
+				fmt.Fprint(w, chunk)
+				w.(http.Flusher).Flush()
+			}
+		})),
+	})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := server.Stop(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	conn, err := net.Dial("tcp", server.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: test\r\nAccept-Encoding: gzip\r\n\r\n")
+	chunks <- "data: first\n\n"
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	response, err := http.ReadResponse(bufio.NewReader(conn), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "gzip", response.Header.Get("Content-Encoding"); actual != expected {
+		t.Fatalf("Expected Content-Encoding=%q but actual=%q", expected, actual)
+	}
+	reader, err := gzip.NewReader(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first event must arrive before the handler finishes.
+	buf := make([]byte, len("data: first\n\n"))
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "data: first\n\n", string(buf); actual != expected {
+		t.Errorf("Expected first streamed chunk=%q but actual=%q", expected, actual)
+	}
+	close(chunks)
+}
@@ -0,0 +1,200 @@
+package web
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	DefaultCorsMethods = []string{"GET", "HEAD", "POST"}
+	DefaultCorsHeaders = []string{"Accept", "Accept-Language", "Content-Language", "Content-Type", "Authorization", RequestIdHeader}
+)
+
+// CorsOptions configures Cross-Origin Resource Sharing.  Preflight requests
+// pass through any middlewares in front of the policy like other requests, so
+// those rejecting requests without credentials (e.g. authentication) must be
+// wrapped with `SkipPreflight()'.
+type CorsOptions struct {
+	AllowedOrigins   []string      // origins permitted to make requests, e.g. "https://app.example.com", "https://*.example.com" or "*" for any.
+	AllowedMethods   []string      // methods permitted in preflight requests, DefaultCorsMethods (or the route's methods when used via `route.RouteMiddlewareBundle') if empty.
+	AllowedHeaders   []string      // request headers permitted in preflight requests, DefaultCorsHeaders if empty, "*" permits any.
+	ExposedHeaders   []string      // response headers readable by the client.
+	AllowCredentials bool          // permit cookies and HTTP authentication, never for origins only permitted by "*".
+	MaxAge           time.Duration // how long preflight responses may be cached, not sent if 0.
+}
+
+// Cors applies a CorsOptions policy to requests.
+type Cors struct {
+	Options CorsOptions
+}
+
+func NewCors(options CorsOptions) *Cors {
+	if len(options.AllowedMethods) == 0 {
+		options.AllowedMethods = DefaultCorsMethods
+	}
+	if len(options.AllowedHeaders) == 0 {
+		options.AllowedHeaders = DefaultCorsHeaders
+	}
+	cors := &Cors{
+		Options: options,
+	}
+	return cors
+}
+
+// Middleware answers preflight requests and adds CORS headers to the
+// responses of permitted cross-origin requests.
+func (cors *Cors) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		origin := req.Header.Get("Origin")
+		if len(origin) == 0 {
+			next.ServeHTTP(w, req)
+			return
+		}
+		if IsPreflight(req) {
+			cors.preflight(w, req, origin)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		if cors.OriginAllowed(origin) {
+			cors.setOriginHeaders(w, origin)
+			if len(cors.Options.ExposedHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(cors.Options.ExposedHeaders, ", "))
+			}
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// IsPreflight reports whether req is a CORS preflight request.
+func IsPreflight(req *http.Request) bool {
+	return req.Method == "OPTIONS" && len(req.Header.Get("Origin")) > 0 && len(req.Header.Get("Access-Control-Request-Method")) > 0
+}
+
+// SkipPreflight wraps middleware so that CORS preflight requests bypass it.
+// Browsers send preflight requests without credentials, so authentication
+// middlewares must be wrapped for preflights to reach the CORS policy, e.g.:
+//
+//     Middlewares: []func(http.Handler) http.Handler{web.SkipPreflight(auth)},
+func SkipPreflight(middleware func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		wrapped := middleware(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if IsPreflight(req) {
+				next.ServeHTTP(w, req)
+				return
+			}
+			wrapped.ServeHTTP(w, req)
+		})
+	}
+}
+
+// preflight responds to a preflight request.  When the request isn't permitted
+// the CORS headers are omitted, which makes the browser block it.
+func (cors *Cors) preflight(w http.ResponseWriter, req *http.Request, origin string) {
+	header := w.Header()
+	header.Add("Vary", "Origin")
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+
+	var (
+		method         = strings.ToUpper(req.Header.Get("Access-Control-Request-Method"))
+		requestHeaders = splitHeaderList(req.Header.Get("Access-Control-Request-Headers"))
+	)
+	if cors.OriginAllowed(origin) && cors.methodAllowed(method) && cors.headersAllowed(requestHeaders) {
+		cors.setOriginHeaders(w, origin)
+		header.Set("Access-Control-Allow-Methods", strings.Join(cors.Options.AllowedMethods, ", "))
+		if len(requestHeaders) > 0 {
+			header.Set("Access-Control-Allow-Headers", strings.Join(requestHeaders, ", "))
+		}
+		if cors.Options.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(int(cors.Options.MaxAge/time.Second)))
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cors *Cors) setOriginHeaders(w http.ResponseWriter, origin string) {
+	if !cors.originListed(origin) {
+		// Permitted by "*" alone, which must never be combined with credentials
+		// as that would expose them to any site.
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	// NB: The origin is echoed rather than sending "*", which browsers reject
+	// for credentialed requests.
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if cors.Options.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// OriginAllowed reports whether origin matches one of the allowed origins.
+func (cors *Cors) OriginAllowed(origin string) bool {
+	if cors.originListed(origin) {
+		return true
+	}
+	for _, allowed := range cors.Options.AllowedOrigins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// originListed reports whether origin matches one of the allowed origins other
+// than "*".
+func (cors *Cors) originListed(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, allowed := range cors.Options.AllowedOrigins {
+		allowed = strings.ToLower(allowed)
+		if allowed == origin {
+			return true
+		}
+		if allowed != "*" && strings.Contains(allowed, "*") {
+			if matched, _ := path.Match(allowed, origin); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (cors *Cors) methodAllowed(method string) bool {
+	for _, allowed := range cors.Options.AllowedMethods {
+		if strings.ToUpper(allowed) == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (cors *Cors) headersAllowed(requestHeaders []string) bool {
+	for _, allowed := range cors.Options.AllowedHeaders {
+		if allowed == "*" {
+			return true
+		}
+	}
+REQUESTED:
+	for _, requested := range requestHeaders {
+		for _, allowed := range cors.Options.AllowedHeaders {
+			if strings.EqualFold(allowed, requested) {
+				continue REQUESTED
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func splitHeaderList(value string) []string {
+	values := []string{}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			values = append(values, v)
+		}
+	}
+	return values
+}
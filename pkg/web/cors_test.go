@@ -0,0 +1,128 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCorsOriginAllowed(t *testing.T) {
+	cors := NewCors(CorsOptions{AllowedOrigins: []string{"https://app.example.com", "https://*.example.org"}})
+	testCases := []struct {
+		origin   string
+		expected bool
+	}{
+		{"https://app.example.com", true},
+		{"https://APP.example.com", true},
+		{"http://app.example.com", false},
+		{"https://evil.com", false},
+		{"https://a.example.org", true},
+		{"https://example.org", false},
+	}
+	for _, testCase := range testCases {
+		if actual := cors.OriginAllowed(testCase.origin); actual != testCase.expected {
+			t.Errorf("Expected OriginAllowed(%q)=%v but actual=%v", testCase.origin, testCase.expected, actual)
+		}
+	}
+	if !NewCors(CorsOptions{AllowedOrigins: []string{"*"}}).OriginAllowed("https://anything.test") {
+		t.Error(`Expected "*" to allow any origin`)
+	}
+}
+
+func TestCorsMiddleware(t *testing.T) {
+	cors := NewCors(CorsOptions{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowedMethods:   []string{"GET", "PUT"},
+		ExposedHeaders:   []string{RequestIdHeader},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+	var invoked bool
+	handler := cors.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		invoked = true
+	}))
+
+	// Preflight.
+	req := httptest.NewRequest("OPTIONS", "/", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	req.Header.Set("Access-Control-Request-Headers", "content-type")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if invoked {
+		t.Error("Expected preflight not to reach the handler")
+	}
+	if expected, actual := http.StatusNoContent, w.Code; actual != expected {
+		t.Errorf("Expected preflight status-code=%v but actual=%v", expected, actual)
+	}
+	expectedHeaders := map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Methods":     "GET, PUT",
+		"Access-Control-Allow-Headers":     "content-type",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Max-Age":           "600",
+	}
+	for name, expected := range expectedHeaders {
+		if actual := w.Header().Get(name); actual != expected {
+			t.Errorf("Expected preflight header %v=%q but actual=%q", name, expected, actual)
+		}
+	}
+
+	// Disallowed preflights get no CORS headers.
+	for _, header := range [][2]string{{"Access-Control-Request-Method", "DELETE"}, {"Access-Control-Request-Headers", "x-custom"}, {"Origin", "https://evil.com"}} {
+		req := httptest.NewRequest("OPTIONS", "/", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", "PUT")
+		req.Header.Set(header[0], header[1])
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if actual := w.Header().Get("Access-Control-Allow-Origin"); len(actual) > 0 {
+			t.Errorf("Expected no Access-Control-Allow-Origin when %v=%v but actual=%q", header[0], header[1], actual)
+		}
+	}
+
+	// Actual request.
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if !invoked {
+		t.Error("Expected cross-origin request to reach the handler")
+	}
+	if expected, actual := "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"); actual != expected {
+		t.Errorf("Expected Access-Control-Allow-Origin=%q but actual=%q", expected, actual)
+	}
+	if expected, actual := RequestIdHeader, w.Header().Get("Access-Control-Expose-Headers"); actual != expected {
+		t.Errorf("Expected Access-Control-Expose-Headers=%q but actual=%q", expected, actual)
+	}
+}
+
+func TestCorsAnyOriginWithCredentials(t *testing.T) {
+	cors := NewCors(CorsOptions{
+		AllowedOrigins:   []string{"https://app.example.com", "*"},
+		AllowCredentials: true,
+	})
+	handler := cors.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+
+	testCases := []struct {
+		origin              string
+		expectedOrigin      string
+		expectedCredentials string
+	}{
+		{"https://app.example.com", "https://app.example.com", "true"},
+		{"https://evil.com", "*", ""},
+	}
+	for _, testCase := range testCases {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Origin", testCase.origin)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if actual := w.Header().Get("Access-Control-Allow-Origin"); actual != testCase.expectedOrigin {
+			t.Errorf("[origin=%v] Expected Access-Control-Allow-Origin=%q but actual=%q", testCase.origin, testCase.expectedOrigin, actual)
+		}
+		if actual := w.Header().Get("Access-Control-Allow-Credentials"); actual != testCase.expectedCredentials {
+			t.Errorf("[origin=%v] Expected Access-Control-Allow-Credentials=%q but actual=%q", testCase.origin, testCase.expectedCredentials, actual)
+		}
+	}
+}
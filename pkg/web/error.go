@@ -2,23 +2,75 @@ package web
 
 import (
 	"fmt"
+	"net/http"
+
+	"github.com/gigawattio/go-commons/pkg/errorlib"
+	"github.com/gigawattio/go-commons/pkg/validation"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/facebookgo/stack"
 )
 
+// JsonError produces a JSON error body.
+//
+// A *validation.ValidationError additionally includes a "fields" list
+// describing each invalid field.
 func JsonError(detail interface{}) Json {
+	return jsonError(log.NewEntry(log.StandardLogger()), detail)
+}
+
+// JsonErrorFor produces a JSON error body like `JsonError()', additionally
+// including the request ID of req (see `RequestIdMiddleware') so the response
+// can be correlated with the logs.
+func JsonErrorFor(req *http.Request, detail interface{}) Json {
+	body := jsonError(RequestLogger(req), detail)
+	if requestId := RequestId(req); len(requestId) > 0 {
+		body["request_id"] = requestId
+	}
+	return body
+}
+
+func jsonError(logger *log.Entry, detail interface{}) Json {
+	var fields []validation.FieldError
 	switch detail.(type) {
+	case *validation.ValidationError:
+		fields = detail.(*validation.ValidationError).Fields
+		detail = detail.(error).Error()
 	case error:
 		detail = detail.(error).Error()
 	case string:
 	default:
 		detail = fmt.Sprint(detail)
 	}
-	log.Errorf("%v: JsonError: detail=%v\n", stack.Caller(1), detail)
+	logger.Errorf("%v: JsonError: detail=%v\n", stack.Caller(2), detail)
+	if fields != nil {
+		return Json{"error": detail, "fields": fields}
+	}
 	return Json{"error": detail}
 }
 
 func JsonErrorf(format string, args ...interface{}) Json {
 	return JsonError(fmt.Sprintf(format, args))
 }
+
+// ErrorStatus maps well-known errors to an HTTP status code, falling back to
+// http.StatusInternalServerError.
+func ErrorStatus(err error) int {
+	switch {
+	case err == errorlib.NotFoundError:
+		return http.StatusNotFound
+	case err == errorlib.NotAuthorizedError:
+		return http.StatusForbidden
+	case validation.IsValidationError(err):
+		return http.StatusUnprocessableEntity
+	case isBindError(err):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func isBindError(err error) bool {
+	_, ok := err.(*BindError)
+	return ok
+}
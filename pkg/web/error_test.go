@@ -0,0 +1,56 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gigawattio/go-commons/pkg/errorlib"
+	"github.com/gigawattio/go-commons/pkg/validation"
+)
+
+func TestJsonErrorValidation(t *testing.T) {
+	ve := &validation.ValidationError{}
+	ve.Add("name", "required", "is required")
+
+	w := httptest.NewRecorder()
+	if _, err := RespondWithJson(w, ErrorStatus(ve), JsonError(ve)); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := http.StatusUnprocessableEntity, w.Code; actual != expected {
+		t.Errorf("Expected status-code=%v but actual=%v", expected, actual)
+	}
+	body := struct {
+		Error  string
+		Fields []validation.FieldError
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := ve.Error(), body.Error; actual != expected {
+		t.Errorf("Expected error=%q but actual=%q", expected, actual)
+	}
+	if len(body.Fields) != 1 || body.Fields[0] != ve.Fields[0] {
+		t.Errorf("Expected fields=%+v but actual=%+v", ve.Fields, body.Fields)
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected int
+	}{
+		{errorlib.NotFoundError, http.StatusNotFound},
+		{errorlib.NotAuthorizedError, http.StatusForbidden},
+		{&validation.ValidationError{}, http.StatusUnprocessableEntity},
+		{&BindError{Err: errors.New("bad json")}, http.StatusBadRequest},
+		{errors.New("boom"), http.StatusInternalServerError},
+	}
+	for _, testCase := range testCases {
+		if actual := ErrorStatus(testCase.err); actual != testCase.expected {
+			t.Errorf("Expected status=%v for err=%v but actual=%v", testCase.expected, testCase.err, actual)
+		}
+	}
+}
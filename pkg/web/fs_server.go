@@ -1,31 +1,32 @@
 package web
 
 import (
+	"context"
 	"net"
 	"net/http"
 	"sync"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/gigawattio/go-commons/pkg/errorlib"
-	"github.com/jaytaylor/stoppableListener"
 )
 
 // FsServer is a filesystem server.
 type FsServer struct {
-	bind     string
-	dir      http.Dir
-	server   *http.Server
-	listener *stoppableListener.StoppableListener
-	lock     sync.Mutex
+	ShutdownTimeout time.Duration // maximum duration `Stop()' waits for in-flight requests, DefaultShutdownTimeout if 0.
+	bind            string
+	dir             http.Dir
+	server          *http.Server
+	listener        net.Listener
+	done            chan struct{} // Closed once `Serve' returns.
+	shutdownHooks   []ShutdownHook
+	lock            sync.Mutex
 }
 
 func NewFsServer(bind string, dir http.Dir) *FsServer {
 	fsServer := &FsServer{
 		bind: bind,
 		dir:  dir,
-		server: &http.Server{
-			Handler: http.FileServer(dir),
-		},
 	}
 	return fsServer
 }
@@ -38,24 +39,44 @@ func (fsServer *FsServer) Start() error {
 		return errorlib.AlreadyRunningError
 	}
 
-	rawListener, err := net.Listen("tcp", fsServer.bind)
+	listener, err := net.Listen("tcp", fsServer.bind)
 	if err != nil {
 		return err
 	}
-	sl, err := stoppableListener.New(rawListener)
-	if err != nil {
-		return err
+	// NB: A new http.Server is required for each run since they cannot be
+	// reused after `Shutdown()'.
+	server := &http.Server{
+		Handler: fsServer.Handler(),
 	}
-	fsServer.listener = sl
+	done := make(chan struct{})
+	fsServer.listener = listener
+	fsServer.server = server
+	fsServer.done = done
 	go func() {
-		if err := fsServer.server.Serve(sl); err != nil && err != stoppableListener.StoppedError {
-			log.Errorf("unexpected error from FsServer.server.Serve(sl): %s", err)
+		defer close(done)
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Errorf("unexpected error from FsServer.server.Serve(listener): %s", err)
 		}
 	}()
 	return nil
 }
 
+// Handler returns the http.Handler which serves the FsServer's directory, e.g.
+// for mounting it in another server's routes (see `route.Mount').
+func (fsServer *FsServer) Handler() http.Handler {
+	return http.FileServer(fsServer.dir)
+}
+
+// Stop gracefully terminates the FsServer, waiting up to `ShutdownTimeout' for
+// in-flight requests to complete.
 func (fsServer *FsServer) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout(fsServer.ShutdownTimeout))
+	defer cancel()
+	return fsServer.Shutdown(ctx)
+}
+
+// Shutdown gracefully terminates the FsServer, see `WebServer.Shutdown()'.
+func (fsServer *FsServer) Shutdown(ctx context.Context) error {
 	fsServer.lock.Lock()
 	defer fsServer.lock.Unlock()
 
@@ -63,11 +84,21 @@ func (fsServer *FsServer) Stop() error {
 		return errorlib.NotRunningError
 	}
 
-	if err := fsServer.listener.Stop(); err != nil {
-		return err
+	errs := []error{
+		drain(ctx, fsServer.server, fsServer.done),
+		runShutdownHooks(ctx, fsServer.shutdownHooks),
 	}
+	fsServer.server = nil
 	fsServer.listener = nil
-	return nil
+	return errorlib.Merge(errs)
+}
+
+// OnShutdown registers a hook to be run during `Shutdown()', after in-flight
+// requests have been drained.
+func (fsServer *FsServer) OnShutdown(hook ShutdownHook) {
+	fsServer.lock.Lock()
+	fsServer.shutdownHooks = append(fsServer.shutdownHooks, hook)
+	fsServer.lock.Unlock()
 }
 
 func (fsServer *FsServer) Addr() net.Addr {
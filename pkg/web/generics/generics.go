@@ -4,9 +4,7 @@ import (
 	"errors"
 	"net/http"
 
-	log "github.com/Sirupsen/logrus"
 	"github.com/facebookgo/stack"
-	"github.com/gigawattio/go-commons/pkg/errorlib"
 	"github.com/gigawattio/go-commons/pkg/web"
 	"github.com/gigawattio/go-commons/pkg/web/helper"
 )
@@ -25,7 +23,8 @@ type (
 // GenericObjectEndpoint takes a function that produces a (result, error) tuple and runs it.
 //
 // statuses[0] may contain the success status code (optional, defaults to http.StatusOK).
-// statuses[1] may contain the failure status code (optional, defaults to httpStatusInternalServerError).
+// statuses[1] may contain the failure status code (optional, defaults to the
+// result of web.ErrorStatus(err)).
 //
 func GenericObjectEndpoint(w http.ResponseWriter, req *http.Request, processorFunc ObjectProcessorFunc, statuses ...int) {
 	var status int
@@ -36,15 +35,11 @@ func GenericObjectEndpoint(w http.ResponseWriter, req *http.Request, processorFu
 		}
 		if len(statuses) > 1 {
 			status = statuses[1] // User-specified error status code.
-		} else if err == errorlib.NotFoundError {
-			status = http.StatusNotFound
-		} else if err == errorlib.NotAuthorizedError {
-			status = http.StatusForbidden
 		} else {
-			status = http.StatusInternalServerError
+			status = web.ErrorStatus(err) // e.g. 404 for errorlib.NotFoundError, 422 for validation errors.
 		}
-		log.Errorf("%v: error running object processor on URI=%v status-code=%v: %s", stack.Caller(3), req.RequestURI, status, err)
-		web.RespondWithJson(w, status, web.JsonError(err))
+		web.RequestLogger(req).Errorf("%v: error running object processor on URI=%v status-code=%v: %s", stack.Caller(3), req.RequestURI, status, err)
+		web.RespondWithJson(w, status, web.JsonErrorFor(req, err))
 		return
 	}
 	if len(statuses) > 0 {
@@ -69,15 +64,11 @@ func GenericObjectsEndpoint(w http.ResponseWriter, req *http.Request, processorF
 		}
 		if len(statuses) > 1 {
 			status = statuses[1] // User-specified error status code.
-		} else if err == errorlib.NotFoundError {
-			status = http.StatusNotFound
-		} else if err == errorlib.NotAuthorizedError {
-			status = http.StatusForbidden
 		} else {
-			status = http.StatusInternalServerError
+			status = web.ErrorStatus(err) // e.g. 404 for errorlib.NotFoundError, 422 for validation errors.
 		}
-		log.Errorf("%v: error running listing processor for URI=%v limit=%v offset=%v: %s", stack.Caller(3), req.RequestURI, limit, offset, err)
-		web.RespondWithJson(w, status, web.JsonError(err))
+		web.RequestLogger(req).Errorf("%v: error running listing processor for URI=%v limit=%v offset=%v: %s", stack.Caller(3), req.RequestURI, limit, offset, err)
+		web.RespondWithJson(w, status, web.JsonErrorFor(req, err))
 		return
 	}
 	response := NewApiResponse(objects, n)
@@ -1,9 +1,12 @@
 package generics
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/gigawattio/go-commons/pkg/web"
@@ -13,7 +16,7 @@ import (
 	"github.com/parnurzeal/gorequest"
 )
 
-func genRoutes() *hitch.Hitch {
+func genRoutes(t *testing.T) *hitch.Hitch {
 	index := func(w http.ResponseWriter, req *http.Request) {
 		web.RespondWithHtml(w, 200, `<html><head><title>hello world</title></head><body>hello world</body></html>`)
 	}
@@ -36,20 +39,23 @@ func genRoutes() *hitch.Hitch {
 	routes := []route.RouteMiddlewareBundle{
 		route.RouteMiddlewareBundle{
 			RouteData: []route.RouteDatum{
-				{"get", "/", index},
-				{"post", "/v1/object", object},
-				{"post", "/v1/objects", objects},
+				{Reciever: "get", Path: "/", HandlerFunc: index},
+				{Reciever: "post", Path: "/v1/object", HandlerFunc: object},
+				{Reciever: "post", Path: "/v1/objects", HandlerFunc: objects},
 			},
 		},
 	}
-	h := route.Activate(routes)
+	h, err := route.Activate(routes)
+	if err != nil {
+		t.Fatal(err)
+	}
 	return h
 }
 
 func TestGenerics(t *testing.T) {
 	options := web.WebServerOptions{
 		Addr:    "127.0.0.1:0",
-		Handler: genRoutes().Handler(),
+		Handler: genRoutes(t).Handler(),
 	}
 	webServer := web.NewWebServer(options)
 
@@ -101,3 +107,76 @@ func TestGenerics(t *testing.T) {
 		}
 	}
 }
+
+func TestGenericsErrorIncludesRequestId(t *testing.T) {
+	handler := web.RequestIdMiddleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		GenericObjectEndpoint(w, req, func() (interface{}, error) {
+			return nil, errors.New("failed")
+		})
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(web.RequestIdHeader, "generics-1")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "generics-1", body["request_id"]; actual != expected {
+		t.Errorf("Expected error body request_id=%v but actual=%v", expected, actual)
+	}
+}
+
+func TestGenericsBindAndValidate(t *testing.T) {
+	type signup struct {
+		Name  string `json:"name" validate:"required"`
+		Email string `json:"email" validate:"required,email"`
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		GenericObjectEndpoint(w, req, func() (interface{}, error) {
+			value := &signup{}
+			if err := web.BindAndValidate(req, value); err != nil {
+				return nil, err
+			}
+			return value, nil
+		})
+	})
+	testCases := []struct {
+		body       string
+		statusCode int
+		fields     []string
+	}{
+		{`{"name": "jay", "email": "jay@example.com"}`, http.StatusCreated, nil},
+		{`{"name": `, http.StatusBadRequest, nil},
+		{`{"email": "nope"}`, http.StatusUnprocessableEntity, []string{"name", "email"}},
+	}
+	for i, testCase := range testCases {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(testCase.body))
+		req.Header.Set("Content-Type", web.MimeJson)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if expected, actual := testCase.statusCode, w.Code; actual != expected {
+			t.Errorf("[i=%v] Expected status-code=%v but actual=%v (body=%s)", i, expected, actual, w.Body.String())
+			continue
+		}
+		if testCase.fields == nil {
+			continue
+		}
+		var body struct {
+			Fields []struct {
+				Field string `json:"field"`
+			} `json:"fields"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		fields := []string{}
+		for _, field := range body.Fields {
+			fields = append(fields, field.Field)
+		}
+		if expected, actual := fmt.Sprint(testCase.fields), fmt.Sprint(fields); actual != expected {
+			t.Errorf("[i=%v] Expected invalid fields=%v but actual=%v", i, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultHealthCheckTimeout bounds checks registered without a Timeout.
+	DefaultHealthCheckTimeout = 5 * time.Second
+
+	DefaultLivenessPath  = "/healthz"
+	DefaultReadinessPath = "/readyz"
+)
+
+const (
+	HealthStatusOk       = "ok"
+	HealthStatusDegraded = "degraded" // Only non-critical checks are failing.
+	HealthStatusFailing  = "failing"
+)
+
+var ShuttingDownError = errors.New("shutting down")
+
+// HealthCheckFunc reports an unhealthy dependency by returning a non-nil
+// error.  It should return promptly once ctx is done.
+type HealthCheckFunc func(ctx context.Context) error
+
+// HealthCheck is a named check registered with `Health.Register()'.
+type HealthCheck struct {
+	Name     string
+	Check    HealthCheckFunc
+	Timeout  time.Duration // maximum duration of the check, DefaultHealthCheckTimeout if 0.
+	Critical bool          // when failing, the overall status is failing rather than degraded.
+	Liveness bool          // also run for liveness, use sparingly since failing liveness gets the process restarted.
+}
+
+// HealthCheckResult is the outcome of a single check.
+type HealthCheckResult struct {
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// HealthReport is the JSON body served by the liveness and readiness
+// endpoints.
+type HealthReport struct {
+	Status string                       `json:"status"`
+	Checks map[string]HealthCheckResult `json:"checks"`
+}
+
+// StatusCode maps the report to http.StatusOK, or
+// http.StatusServiceUnavailable when failing.
+func (report HealthReport) StatusCode() int {
+	if report.Status == HealthStatusFailing {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
+
+// Health runs registered checks and serves liveness and readiness endpoints.
+//
+// Liveness answers "is the process alive" and only runs checks flagged with
+// Liveness, while readiness answers "should traffic be routed here" and runs
+// every check.  Readiness fails while an attached WebServer is shutting down
+// (see `WebServerOptions.Health').
+//
+// Example usage:
+//
+//     health := web.NewHealth()
+//     health.Register(web.HealthCheck{
+//         Name:     "db",
+//         Check:    web.RepositoryHealthCheck(driver),
+//         Critical: true,
+//     })
+//     ws := web.NewWebServer(web.WebServerOptions{Addr: ":8080", Handler: h, Health: health})
+type Health struct {
+	LivenessPath  string // DefaultLivenessPath if empty.
+	ReadinessPath string // DefaultReadinessPath if empty.
+	checks        []HealthCheck
+	shuttingDown  bool
+	lock          sync.RWMutex
+}
+
+func NewHealth() *Health {
+	health := &Health{}
+	return health
+}
+
+// Register adds a check.  Names must be unique.
+func (health *Health) Register(check HealthCheck) error {
+	if len(check.Name) == 0 {
+		return errors.New("web.Health: check name must not be empty")
+	}
+	if check.Check == nil {
+		return fmt.Errorf("web.Health: check %q must not have a nil Check func", check.Name)
+	}
+	health.lock.Lock()
+	defer health.lock.Unlock()
+	for _, existing := range health.checks {
+		if existing.Name == check.Name {
+			return fmt.Errorf("web.Health: check %q is already registered", check.Name)
+		}
+	}
+	health.checks = append(health.checks, check)
+	return nil
+}
+
+// Names returns the names of the registered checks, sorted.
+func (health *Health) Names() []string {
+	health.lock.RLock()
+	names := make([]string, 0, len(health.checks))
+	for _, check := range health.checks {
+		names = append(names, check.Name)
+	}
+	health.lock.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// Liveness runs the liveness checks.
+func (health *Health) Liveness(ctx context.Context) HealthReport {
+	health.lock.RLock()
+	checks := []HealthCheck{}
+	for _, check := range health.checks {
+		if check.Liveness {
+			checks = append(checks, check)
+		}
+	}
+	health.lock.RUnlock()
+	return runHealthChecks(ctx, checks)
+}
+
+// Readiness runs all checks, or immediately reports failing while shutting
+// down.
+func (health *Health) Readiness(ctx context.Context) HealthReport {
+	health.lock.RLock()
+	var (
+		checks       = append([]HealthCheck{}, health.checks...)
+		shuttingDown = health.shuttingDown
+	)
+	health.lock.RUnlock()
+	if shuttingDown {
+		report := HealthReport{
+			Status: HealthStatusFailing,
+			Checks: map[string]HealthCheckResult{
+				"shutdown": {Status: HealthStatusFailing, Critical: true, Duration: "0s", Error: ShuttingDownError.Error()},
+			},
+		}
+		return report
+	}
+	return runHealthChecks(ctx, checks)
+}
+
+// SetShuttingDown toggles readiness failing regardless of the checks.  An
+// attached WebServer does this automatically.
+func (health *Health) SetShuttingDown(shuttingDown bool) {
+	health.lock.Lock()
+	health.shuttingDown = shuttingDown
+	health.lock.Unlock()
+}
+
+func (health *Health) LivenessHandler() http.Handler {
+	return healthHandler(health.Liveness)
+}
+
+func (health *Health) ReadinessHandler() http.Handler {
+	return healthHandler(health.Readiness)
+}
+
+// Middleware serves the liveness and readiness endpoints and passes all other
+// requests through to next.
+func (health *Health) Middleware(next http.Handler) http.Handler {
+	var (
+		liveness  = health.LivenessHandler()
+		readiness = health.ReadinessHandler()
+	)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == "GET" || req.Method == "HEAD" {
+			switch req.URL.Path {
+			case health.livenessPath():
+				liveness.ServeHTTP(w, req)
+				return
+			case health.readinessPath():
+				readiness.ServeHTTP(w, req)
+				return
+			}
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func (health *Health) livenessPath() string {
+	if len(health.LivenessPath) > 0 {
+		return health.LivenessPath
+	}
+	return DefaultLivenessPath
+}
+
+func (health *Health) readinessPath() string {
+	if len(health.ReadinessPath) > 0 {
+		return health.ReadinessPath
+	}
+	return DefaultReadinessPath
+}
+
+// Pinger is satisfied by `repository.RepositoryDriver'.
+type Pinger interface {
+	Ping() error
+}
+
+// RepositoryHealthCheck produces a check which verifies the driver can reach
+// its data-store.
+func RepositoryHealthCheck(driver Pinger) HealthCheckFunc {
+	return func(_ context.Context) error {
+		return driver.Ping()
+	}
+}
+
+func healthHandler(fn func(ctx context.Context) HealthReport) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		report := fn(req.Context())
+		w.Header().Set("Cache-Control", "no-cache, no-store")
+		RespondWithJson(w, report.StatusCode(), report)
+	})
+}
+
+// runHealthChecks runs checks concurrently, each bounded by its timeout.
+func runHealthChecks(ctx context.Context, checks []HealthCheck) HealthReport {
+	type namedResult struct {
+		name   string
+		result HealthCheckResult
+	}
+	results := make(chan namedResult, len(checks))
+	for _, check := range checks {
+		go func(check HealthCheck) {
+			results <- namedResult{check.Name, runHealthCheck(ctx, check)}
+		}(check)
+	}
+
+	report := HealthReport{
+		Status: HealthStatusOk,
+		Checks: map[string]HealthCheckResult{},
+	}
+	for range checks {
+		r := <-results
+		report.Checks[r.name] = r.result
+		if r.result.Status == HealthStatusOk {
+			continue
+		}
+		if r.result.Critical {
+			report.Status = HealthStatusFailing
+		} else if report.Status == HealthStatusOk {
+			report.Status = HealthStatusDegraded
+		}
+	}
+	return report
+}
+
+func runHealthCheck(ctx context.Context, check HealthCheck) HealthCheckResult {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHealthCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var (
+		started = time.Now()
+		errCh   = make(chan error, 1) // NB: Buffered so a check ignoring ctx doesn't leak its goroutine forever.
+		err     error
+	)
+	go func() {
+		errCh <- check.Check(ctx)
+	}()
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		if err = ctx.Err(); err == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %s", timeout)
+		}
+	}
+
+	result := HealthCheckResult{
+		Status:   HealthStatusOk,
+		Critical: check.Critical,
+		Duration: time.Since(started).String(),
+	}
+	if err != nil {
+		result.Status = HealthStatusFailing
+		result.Error = err.Error()
+	}
+	return result
+}
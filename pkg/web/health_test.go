@@ -0,0 +1,164 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type pingerFunc func() error
+
+func (fn pingerFunc) Ping() error { return fn() }
+
+func getHealthReport(t *testing.T, url string) (int, HealthReport) {
+	response, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var report HealthReport
+	if err := json.NewDecoder(response.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	return response.StatusCode, report
+}
+
+func TestHealthChecks(t *testing.T) {
+	var dbErr error
+	health := NewHealth()
+	checks := []HealthCheck{
+		{Name: "db", Check: RepositoryHealthCheck(pingerFunc(func() error { return dbErr })), Critical: true},
+		{Name: "cache", Check: func(_ context.Context) error { return errors.New("cache unreachable") }},
+		{Name: "slow", Check: func(ctx context.Context) error { <-ctx.Done(); return nil }, Timeout: 10 * time.Millisecond},
+		{Name: "alive", Check: func(_ context.Context) error { return nil }, Liveness: true},
+	}
+	for _, check := range checks {
+		if err := health.Register(check); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := health.Register(checks[0]); err == nil {
+		t.Error("Expected registering a duplicate check name to fail")
+	}
+
+	report := health.Readiness(context.Background())
+	if expected, actual := HealthStatusDegraded, report.Status; actual != expected {
+		t.Errorf("Expected readiness status=%v but actual=%v", expected, actual)
+	}
+	if expected, actual := "timed out after 10ms", report.Checks["slow"].Error; actual != expected {
+		t.Errorf("Expected slow check error=%q but actual=%q", expected, actual)
+	}
+	if expected, actual := HealthStatusOk, report.Checks["db"].Status; actual != expected {
+		t.Errorf("Expected db check status=%v but actual=%v", expected, actual)
+	}
+
+	dbErr = errors.New("connection refused")
+	report = health.Readiness(context.Background())
+	if expected, actual := HealthStatusFailing, report.Status; actual != expected {
+		t.Errorf("Expected readiness status=%v with a failing critical check but actual=%v", expected, actual)
+	}
+	if expected, actual := http.StatusServiceUnavailable, report.StatusCode(); actual != expected {
+		t.Errorf("Expected status-code=%v but actual=%v", expected, actual)
+	}
+
+	report = health.Liveness(context.Background())
+	if expected, actual := HealthStatusOk, report.Status; actual != expected {
+		t.Errorf("Expected liveness status=%v but actual=%v", expected, actual)
+	}
+	if expected, actual := 1, len(report.Checks); actual != expected {
+		t.Errorf("Expected %v liveness check but actual=%v", expected, actual)
+	}
+}
+
+func TestWebServerHealthDuringShutdown(t *testing.T) {
+	health := NewHealth()
+	options := WebServerOptions{
+		Addr:              testAddr,
+		Health:            health,
+		HealthGracePeriod: 200 * time.Millisecond,
+	}
+	server := NewStaticWebServer(options, []byte("app"), http.StatusOK, nil)
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	baseUrl := server.BaseUrl()
+
+	if expected, actual := "app", getBody(t, http.DefaultClient, baseUrl+"/"); actual != expected {
+		t.Errorf("Expected body=%q but actual=%q", expected, actual)
+	}
+	statusCode, report := getHealthReport(t, baseUrl+DefaultReadinessPath)
+	if expected, actual := http.StatusOK, statusCode; actual != expected {
+		t.Errorf("Expected readiness status-code=%v but actual=%v", expected, actual)
+	}
+	if expected, actual := HealthStatusOk, report.Status; actual != expected {
+		t.Errorf("Expected readiness status=%v but actual=%v", expected, actual)
+	}
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- server.Stop()
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// Still accepting connections during the grace period, but not ready.
+	statusCode, report = getHealthReport(t, baseUrl+DefaultReadinessPath)
+	if expected, actual := http.StatusServiceUnavailable, statusCode; actual != expected {
+		t.Errorf("Expected readiness status-code=%v during shutdown but actual=%v", expected, actual)
+	}
+	if expected, actual := HealthStatusFailing, report.Status; actual != expected {
+		t.Errorf("Expected readiness status=%v during shutdown but actual=%v", expected, actual)
+	}
+	statusCode, _ = getHealthReport(t, baseUrl+DefaultLivenessPath)
+	if expected, actual := http.StatusOK, statusCode; actual != expected {
+		t.Errorf("Expected liveness status-code=%v during shutdown but actual=%v", expected, actual)
+	}
+
+	if err := <-stopped; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWebServerHealthGracePeriodExceedingShutdownTimeout(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		close(started)
+		time.Sleep(300 * time.Millisecond)
+		w.Write([]byte("finished"))
+	})
+	server := NewWebServer(WebServerOptions{
+		Addr:              testAddr,
+		Handler:           handler,
+		ShutdownTimeout:   150 * time.Millisecond,
+		Health:            NewHealth(),
+		HealthGracePeriod: 200 * time.Millisecond,
+	})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	bodies := make(chan string, 1)
+	go func() {
+		response, err := http.Get(server.BaseUrl())
+		if err != nil {
+			bodies <- err.Error()
+			return
+		}
+		defer response.Body.Close()
+		body, _ := ioutil.ReadAll(response.Body)
+		bodies <- string(body)
+	}()
+	<-started
+
+	// The request outlasts the grace period, but completes well within the
+	// shutdown timeout which follows it.
+	if err := server.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "finished", <-bodies; actual != expected {
+		t.Errorf("Expected slow request to complete with body=%q but actual=%q", expected, actual)
+	}
+}
@@ -0,0 +1,180 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/gigawattio/go-commons/pkg/errorlib"
+)
+
+// Hot restarts hand the listening sockets of a running WebServer to a freshly
+// exec'd copy of the (possibly upgraded) binary, allowing upgrades without
+// refusing any connections:
+//
+//     1. The parent receives HotRestartSignal and invokes `HotRestart()', which
+//        starts the child with the sockets as inherited file descriptors.
+//     2. The child's WebServer serves on the inherited sockets instead of
+//        binding new ones, then calls `NotifyHotRestartReady()'.
+//     3. The parent receives SIGTERM, gracefully drains and exits.
+//
+// `cli.Cli.RunWeb' takes care of steps 1 and 2 as well as the shutdown in 3.
+
+// HotRestartSignal triggers a hot restart when received by `cli.Cli.RunWeb'.
+var HotRestartSignal os.Signal = syscall.SIGUSR2
+
+const (
+	hotRestartFdsEnv    = "WEB_HOT_RESTART_FDS"  // Colon-separated listener kinds, one per inherited descriptor starting at fd 3.
+	hotRestartParentEnv = "WEB_HOT_RESTART_PPID" // Pid of the parent to notify once serving.
+
+	hotRestartMain     = "main"
+	hotRestartRedirect = "redirect"
+)
+
+var HotRestartUnsupportedListenerError = errors.New("hot restart is only supported for TCP and Unix socket listeners")
+
+// HotRestart starts a new instance of the running binary, with the same
+// arguments and environment, which inherits this WebServer's listening
+// sockets.  The WebServer keeps serving; it is up to the caller to shut it down
+// once the new process is ready (see `NotifyHotRestartReady').
+//
+// NB: Process supervisors which track the original pid (e.g. upstart without
+// `expect fork') will consider the service stopped once the parent exits.
+func (ws *WebServer) HotRestart() (*os.Process, error) {
+	ws.lock.RLock()
+	if ws.server == nil || ws.listeners == nil || ws.stopping {
+		ws.lock.RUnlock()
+		return nil, errorlib.NotRunningError
+	}
+	var (
+		files = []*os.File{}
+		kinds = []string{}
+		err   error
+	)
+	for _, listener := range ws.listeners {
+		var file *os.File
+		if file, err = listenerFile(listener); err != nil {
+			break
+		}
+		files = append(files, file)
+		kinds = append(kinds, hotRestartMain)
+	}
+	if err == nil && ws.redirectListener != nil {
+		var file *os.File
+		if file, err = listenerFile(ws.redirectListener); err == nil {
+			files = append(files, file)
+			kinds = append(kinds, hotRestartRedirect)
+		}
+	}
+	ws.lock.RUnlock()
+
+	// NB: The child receives its own copies of the descriptors.
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolve the binary path anew so an upgraded binary is picked up.
+	path, err := exec.LookPath(os.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Env = append(
+		os.Environ(),
+		hotRestartFdsEnv+"="+strings.Join(kinds, ":"),
+		hotRestartParentEnv+"="+strconv.Itoa(os.Getpid()),
+	)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("web.WebServer: starting hot restart process: %s", err)
+	}
+	return cmd.Process, nil
+}
+
+// NotifyHotRestartReady signals the parent process to gracefully shut down
+// when the current process was started by `HotRestart()'.  Otherwise it does
+// nothing.
+func NotifyHotRestartReady() error {
+	ppidStr := os.Getenv(hotRestartParentEnv)
+	if len(ppidStr) == 0 {
+		return nil
+	}
+	os.Unsetenv(hotRestartParentEnv)
+
+	ppid, err := strconv.Atoi(ppidStr)
+	if err != nil {
+		return fmt.Errorf("invalid %v=%q: %s", hotRestartParentEnv, ppidStr, err)
+	}
+	process, err := os.FindProcess(ppid)
+	if err != nil {
+		return err
+	}
+	return process.Signal(syscall.SIGTERM)
+}
+
+// hotRestartListeners returns the listeners inherited from a parent process via
+// `HotRestart()', if any.
+func hotRestartListeners() (listeners []net.Listener, redirectListener net.Listener, err error) {
+	fdsStr := os.Getenv(hotRestartFdsEnv)
+	if len(fdsStr) == 0 {
+		return
+	}
+	os.Unsetenv(hotRestartFdsEnv)
+
+	for i, kind := range strings.Split(fdsStr, ":") {
+		fd := listenFdsStart + i
+		syscall.CloseOnExec(fd)
+		file := os.NewFile(uintptr(fd), fmt.Sprintf("%v_%v", hotRestartFdsEnv, i))
+		var listener net.Listener
+		listener, err = net.FileListener(file)
+		file.Close()
+		if err != nil {
+			err = fmt.Errorf("inheriting listener fd=%v: %s", fd, err)
+			break
+		}
+		if unixListener, ok := listener.(*net.UnixListener); ok {
+			// Clean up the socket file when this process is done with it.
+			unixListener.SetUnlinkOnClose(true)
+		}
+		if kind == hotRestartRedirect {
+			redirectListener = listener
+		} else {
+			listeners = append(listeners, listener)
+		}
+	}
+	if err != nil {
+		closeListeners(listeners)
+		if redirectListener != nil {
+			redirectListener.Close()
+		}
+		return nil, nil, err
+	}
+	return
+}
+
+// listenerFile returns a duplicate descriptor for listener.
+func listenerFile(listener net.Listener) (*os.File, error) {
+	switch l := listener.(type) {
+	case *net.TCPListener:
+		return l.File()
+	case *net.UnixListener:
+		// The socket file must outlive this process's listener.
+		l.SetUnlinkOnClose(false)
+		return l.File()
+	default:
+		return nil, HotRestartUnsupportedListenerError
+	}
+}
@@ -0,0 +1,67 @@
+package web
+
+import (
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestHotRestartListenerHandoff(t *testing.T) {
+	parent := NewStaticWebServer(WebServerOptions{Addr: testAddr}, []byte("parent"), http.StatusOK, nil)
+	if err := parent.Start(); err != nil {
+		t.Fatal(err)
+	}
+	addr := parent.Addr().String()
+
+	// Simulate the descriptor passing performed by `HotRestart()'.
+	file, err := listenerFile(parent.listeners[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd, err := syscall.Dup(int(file.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	backup := listenFdsStart
+	listenFdsStart = fd
+	defer func() { listenFdsStart = backup }()
+	os.Setenv(hotRestartFdsEnv, hotRestartMain)
+
+	// NB: Addr is deliberately taken, binding it would fail.
+	child := NewStaticWebServer(WebServerOptions{Addr: addr}, []byte("child"), http.StatusOK, nil)
+	if err := child.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := child.Stop(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	if len(os.Getenv(hotRestartFdsEnv)) > 0 {
+		t.Errorf("Expected %v to be unset after inheriting listeners", hotRestartFdsEnv)
+	}
+	if expected, actual := addr, child.Addr().String(); actual != expected {
+		t.Errorf("Expected child to serve on addr=%v but actual=%v", expected, actual)
+	}
+
+	// Once the parent has drained, all requests go to the child.
+	if err := parent.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "child", getBody(t, &http.Client{}, "http://"+addr+"/"); actual != expected {
+		t.Errorf("Expected body=%q but actual=%q", expected, actual)
+	}
+
+	// Not a hot restart child, so this must be a no-op.
+	if err := NotifyHotRestartReady(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHotRestartNotRunning(t *testing.T) {
+	if _, err := NewWebServer(WebServerOptions{Addr: testAddr}).HotRestart(); err == nil {
+		t.Error("Expected an error hot restarting a server which isn't running")
+	}
+}
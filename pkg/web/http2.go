@@ -0,0 +1,44 @@
+package web
+
+import (
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// configureHTTP2 enables HTTP/2 on server according to `Options.HTTP2' and
+// `Options.H2C'.  Must be invoked before the TLS listener is created, since the
+// TLS config is updated to advertise "h2".
+func (ws *WebServer) configureHTTP2(server *http.Server, useTLS bool) error {
+	if !ws.Options.HTTP2 && !ws.Options.H2C {
+		return nil
+	}
+	h2Server := &http2.Server{
+		MaxConcurrentStreams: ws.Options.MaxConcurrentStreams,
+	}
+	// NB: Configuring the server also lets `Shutdown()' gracefully close
+	// HTTP/2 connections (including h2c ones) with a GOAWAY frame.
+	if err := http2.ConfigureServer(server, h2Server); err != nil {
+		return err
+	}
+	if useTLS && !ws.Options.HTTP2 {
+		// Only h2c was requested, don't offer HTTP/2 during TLS negotiation.
+		delete(server.TLSNextProto, http2.NextProtoTLS)
+		protos := []string{}
+		for _, proto := range server.TLSConfig.NextProtos {
+			if proto != http2.NextProtoTLS {
+				protos = append(protos, proto)
+			}
+		}
+		server.TLSConfig.NextProtos = protos
+	}
+	if ws.Options.H2C {
+		handler := server.Handler
+		if handler == nil {
+			handler = http.DefaultServeMux
+		}
+		server.Handler = h2c.NewHandler(handler, h2Server)
+	}
+	return nil
+}
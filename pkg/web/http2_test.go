@@ -0,0 +1,141 @@
+package web
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/http2"
+)
+
+// protoHandler responds with the protocol of the request.
+var protoHandler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+	fmt.Fprint(w, req.Proto)
+})
+
+func TestWebServerHTTP2OverTLS(t *testing.T) {
+	ca := genTestCert(t, 1, nil)
+	options := WebServerOptions{
+		Addr:                 testAddr,
+		Handler:              protoHandler,
+		TLSConfig:            &tls.Config{Certificates: []tls.Certificate{genTestCert(t, 2, ca).tlsCertificate(t)}},
+		HTTP2:                true,
+		MaxConcurrentStreams: 10,
+	}
+	server := NewWebServer(options)
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := server.Stop(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	client := &http.Client{
+		Transport: &http2.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		},
+	}
+	response, err := client.Get(server.BaseUrl())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "HTTP/2.0", string(body); actual != expected {
+		t.Errorf("Expected request protocol=%v but actual=%v", expected, actual)
+	}
+
+	// HTTP/1.1 clients continue to work.
+	response, err = tlsTestClient(ca).Get(server.BaseUrl())
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if expected, actual := 1, response.ProtoMajor; actual != expected {
+		t.Errorf("Expected HTTP/1.1 client to get protocol major version=%v but actual=%v", expected, actual)
+	}
+}
+
+func TestWebServerH2C(t *testing.T) {
+	server := NewWebServer(WebServerOptions{Addr: testAddr, Handler: protoHandler, H2C: true})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := server.Stop(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// Prior knowledge.
+	client := &http.Client{
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network string, addr string, _ *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		},
+	}
+	response, err := client.Get(server.BaseUrl())
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "HTTP/2.0", string(body); actual != expected {
+		t.Errorf("Expected prior-knowledge request protocol=%v but actual=%v", expected, actual)
+	}
+
+	// Upgrade.
+	conn, err := net.Dial("tcp", server.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	upgradeRequest := "GET / HTTP/1.1\r\n" +
+		"Host: " + server.Addr().String() + "\r\n" +
+		"Connection: Upgrade, HTTP2-Settings\r\n" +
+		"Upgrade: h2c\r\n" +
+		"HTTP2-Settings: AAMAAABkAAQAAP__\r\n" +
+		"\r\n"
+	if _, err := conn.Write([]byte(upgradeRequest)); err != nil {
+		t.Fatal(err)
+	}
+	statusLine, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(statusLine, "101") {
+		t.Errorf("Expected h2c upgrade to respond with 101 Switching Protocols but status-line=%q", statusLine)
+	}
+
+	// Plain HTTP/1.1 continues to work.
+	response, err = http.Get(server.BaseUrl())
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err = ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "HTTP/1.1", string(body); actual != expected {
+		t.Errorf("Expected request protocol=%v but actual=%v", expected, actual)
+	}
+}
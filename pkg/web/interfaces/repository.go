@@ -0,0 +1,9 @@
+package interfaces
+
+import (
+	"github.com/gigawattio/go-commons/pkg/driver/repository"
+
+	cliv2 "gopkg.in/urfave/cli.v2"
+)
+
+type RepositoryProvider func(ctx *cliv2.Context) (repository.RepositoryDriver, error)
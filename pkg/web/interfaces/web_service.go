@@ -2,6 +2,7 @@ package interfaces
 
 import (
 	"net"
+	"os"
 
 	cliv2 "gopkg.in/urfave/cli.v2"
 )
@@ -13,3 +14,9 @@ type WebService interface {
 }
 
 type WebServiceProvider func(ctx *cliv2.Context) (WebService, error)
+
+// HotRestarter is implemented by web services which support zero-downtime
+// restarts, see `web.WebServer.HotRestart()'.
+type HotRestarter interface {
+	HotRestart() (*os.Process, error)
+}
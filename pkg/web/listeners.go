@@ -0,0 +1,176 @@
+package web
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// UnixAddrPrefix marks an address as a Unix domain socket path, e.g.
+// "unix:/var/run/my-service.sock".
+const UnixAddrPrefix = "unix:"
+
+// DefaultSocketMode is the permission mode applied to Unix domain sockets when
+// `WebServerOptions.SocketMode' is 0.
+var DefaultSocketMode os.FileMode = 0660
+
+// listenFdsStart is the first file descriptor passed by systemd socket
+// activation.
+var listenFdsStart = 3
+
+// SystemdListeners returns the listeners passed to the process via systemd
+// socket activation (the LISTEN_PID and LISTEN_FDS environment variables),
+// or nil when there are none.
+//
+// The environment variables are unset so the listeners aren't inherited a
+// second time by child processes.
+func SystemdListeners() ([]net.Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	numFds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || numFds <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	listeners := make([]net.Listener, 0, numFds)
+	for i := 0; i < numFds; i++ {
+		fd := listenFdsStart + i
+		syscall.CloseOnExec(fd)
+		name := fmt.Sprintf("LISTEN_FD_%v", fd)
+		if i < len(names) && len(names[i]) > 0 {
+			name = names[i]
+		}
+		file := os.NewFile(uintptr(fd), name)
+		listener, err := net.FileListener(file)
+		// NB: FileListener dups the descriptor, so the original is always closed.
+		file.Close()
+		if err != nil {
+			closeListeners(listeners)
+			return nil, fmt.Errorf("inheriting listener fd=%v name=%v: %s", fd, name, err)
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// listen opens a listener for addr, which is either a TCP address or a Unix
+// socket path prefixed with UnixAddrPrefix.
+func (ws *WebServer) listen(addr string) (net.Listener, error) {
+	if !strings.HasPrefix(addr, UnixAddrPrefix) {
+		return net.Listen("tcp", addr)
+	}
+
+	path := strings.TrimPrefix(addr, UnixAddrPrefix)
+	// Remove stale sockets left behind by an unclean exit.
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("unix socket %v is already in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := ws.applySocketPermissions(path); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// applySocketPermissions sets the mode and ownership of a Unix socket according
+// to the options.
+func (ws *WebServer) applySocketPermissions(path string) error {
+	mode := ws.Options.SocketMode
+	if mode == 0 {
+		mode = DefaultSocketMode
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		return err
+	}
+	uid, gid := -1, -1
+	if len(ws.Options.SocketUser) > 0 {
+		u, err := user.Lookup(ws.Options.SocketUser)
+		if err != nil {
+			return err
+		}
+		if uid, err = strconv.Atoi(u.Uid); err != nil {
+			return err
+		}
+	}
+	if len(ws.Options.SocketGroup) > 0 {
+		g, err := user.LookupGroup(ws.Options.SocketGroup)
+		if err != nil {
+			return err
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return err
+		}
+	}
+	if uid != -1 || gid != -1 {
+		if err := os.Chown(path, uid, gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openListeners opens all listeners specified by the options.
+//
+// When socket activation is enabled and listeners were passed by systemd they
+// are used, and `Options.Addr' is only bound when explicitly set.
+func (ws *WebServer) openListeners() ([]net.Listener, error) {
+	listeners := []net.Listener{}
+	if ws.Options.SocketActivation {
+		inherited, err := SystemdListeners()
+		if err != nil {
+			return nil, err
+		}
+		if len(inherited) > 0 {
+			log.Infof("web.WebServer: inherited %v listener(s) via socket activation", len(inherited))
+		}
+		listeners = append(listeners, inherited...)
+	}
+
+	addrs := []string{}
+	if len(listeners) == 0 || len(ws.Options.Addr) > 0 {
+		addrs = append(addrs, ws.Options.Addr)
+	}
+	addrs = append(addrs, ws.Options.Addrs...)
+	for _, addr := range addrs {
+		listener, err := ws.listen(addr)
+		if err != nil {
+			closeListeners(listeners)
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+func closeListeners(listeners []net.Listener) {
+	for _, listener := range listeners {
+		if err := listener.Close(); err != nil {
+			log.Errorf("web: closing listener addr=%v: %s", listener.Addr(), err)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// unixClient produces an HTTP client which connects to the Unix socket at path.
+func unixClient(path string) *http.Client {
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		},
+	}
+	return client
+}
+
+func getBody(t *testing.T, client *http.Client, url string) string {
+	response, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestWebServerUnixSocketAndMultipleAddrs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "web-unix-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "web.sock")
+
+	options := WebServerOptions{
+		Addr:       testAddr,
+		Addrs:      []string{UnixAddrPrefix + socketPath, testAddr},
+		SocketMode: 0600,
+	}
+	server := NewStaticWebServer(options, []byte("multi"), http.StatusOK, nil)
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := server.Stop(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
+			t.Errorf("Expected socket file to be removed after Stop but stat err=%v", err)
+		}
+	}()
+
+	addrs := server.Addrs()
+	if expected, actual := 3, len(addrs); actual != expected {
+		t.Fatalf("Expected %v listener addresses but actual=%v", expected, actual)
+	}
+	for _, addr := range []net.Addr{addrs[0], addrs[2]} {
+		if expected, actual := "multi", getBody(t, http.DefaultClient, fmt.Sprintf("http://%v/", addr)); actual != expected {
+			t.Errorf("Expected body=%q from addr=%v but actual=%q", expected, addr, actual)
+		}
+	}
+	if expected, actual := "multi", getBody(t, unixClient(socketPath), "http://unix/"); actual != expected {
+		t.Errorf("Expected body=%q from unix socket but actual=%q", expected, actual)
+	}
+
+	info, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := os.FileMode(0600), info.Mode().Perm(); actual != expected {
+		t.Errorf("Expected socket mode=%v but actual=%v", expected, actual)
+	}
+}
+
+func TestWebServerSocketActivation(t *testing.T) {
+	// Simulate systemd by passing a pre-opened listener's descriptor.
+	preOpened, err := net.Listen("tcp", testAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := preOpened.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// NB: Dup the descriptor since it becomes owned by the server.
+	fd, err := syscall.Dup(int(file.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	preOpened.Close()
+
+	backup := listenFdsStart
+	listenFdsStart = fd
+	defer func() { listenFdsStart = backup }()
+	os.Setenv("LISTEN_PID", fmt.Sprint(os.Getpid()))
+	os.Setenv("LISTEN_FDS", "1")
+
+	server := NewStaticWebServer(WebServerOptions{SocketActivation: true}, []byte("activated"), http.StatusOK, nil)
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := server.Stop(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	if len(os.Getenv("LISTEN_FDS")) > 0 {
+		t.Error("Expected LISTEN_FDS to be unset after inheriting listeners")
+	}
+	if expected, actual := 1, len(server.Addrs()); actual != expected {
+		t.Fatalf("Expected %v inherited listener but actual=%v", expected, actual)
+	}
+	if expected, actual := "activated", getBody(t, http.DefaultClient, server.BaseUrl()); actual != expected {
+		t.Errorf("Expected body=%q but actual=%q", expected, actual)
+	}
+}
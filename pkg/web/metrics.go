@@ -0,0 +1,301 @@
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultLatencyBuckets are the upper bounds, in seconds, of the request
+	// duration histogram.
+	DefaultLatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	// DefaultSizeBuckets are the upper bounds, in bytes, of the response size
+	// histogram.
+	DefaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+)
+
+// MetricsContentType is the Prometheus text exposition format.
+const MetricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// UnmatchedRoute is the route label for requests which didn't match any route.
+const UnmatchedRoute = "<unmatched>"
+
+type MetricsOptions struct {
+	Namespace      string    // optional prefix for the metric names, e.g. "myapp" produces "myapp_http_requests_total".
+	LatencyBuckets []float64 // DefaultLatencyBuckets if nil.
+	SizeBuckets    []float64 // DefaultSizeBuckets if nil.
+}
+
+// Metrics records per-route HTTP request metrics and serves them, along with
+// Go runtime stats, in the Prometheus text exposition format.
+//
+// Example usage:
+//
+//     metrics := web.NewMetrics(web.MetricsOptions{Namespace: "myapp"})
+//     h, err := route.Activate([]route.RouteMiddlewareBundle{
+//         {
+//             Middlewares: []func(http.Handler) http.Handler{metrics.Middleware},
+//             RouteData: []route.RouteDatum{
+//                 {Reciever: "get", Path: "/metrics", HandlerFunc: metrics.Handler().ServeHTTP},
+//                 ...
+//             },
+//         },
+//     })
+//
+// Routes are labelled by their path template (e.g. "/users/:id") rather than
+// the raw URL to keep the number of series bounded.
+type Metrics struct {
+	Options MetricsOptions
+	series  map[metricsLabels]*requestSeries
+	lock    sync.Mutex
+}
+
+type metricsLabels struct {
+	method string
+	route  string
+	code   string
+}
+
+type requestSeries struct {
+	count    uint64
+	duration *histogram
+	size     *histogram
+}
+
+type histogram struct {
+	bounds []float64
+	counts []uint64 // NB: Per bucket, not cumulative.
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	h := &histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)),
+	}
+	return h
+}
+
+func (h *histogram) observe(value float64) {
+	if i := sort.SearchFloat64s(h.bounds, value); i < len(h.bounds) {
+		h.counts[i]++
+	}
+	h.sum += value
+	h.count++
+}
+
+func NewMetrics(options MetricsOptions) *Metrics {
+	if options.LatencyBuckets == nil {
+		options.LatencyBuckets = DefaultLatencyBuckets
+	}
+	if options.SizeBuckets == nil {
+		options.SizeBuckets = DefaultSizeBuckets
+	}
+	metrics := &Metrics{
+		Options: options,
+		series:  map[metricsLabels]*requestSeries{},
+	}
+	return metrics
+}
+
+// Middleware records the count, latency and response size of each request.
+func (metrics *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		started := time.Now()
+		req = TrackRoutePattern(req)
+		cw := NewCapturingResponseWriter(w)
+		next.ServeHTTP(cw.Writer(), req)
+		metrics.Observe(req.Method, RoutePattern(req), cw.StatusCode, time.Since(started), cw.Bytes)
+	})
+}
+
+// Observe records a single request.  An empty route is recorded as
+// UnmatchedRoute.
+func (metrics *Metrics) Observe(method string, route string, statusCode int, duration time.Duration, size int64) {
+	if len(route) == 0 {
+		route = UnmatchedRoute
+	}
+	labels := metricsLabels{
+		method: strings.ToUpper(method),
+		route:  route,
+		code:   strconv.Itoa(statusCode),
+	}
+
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+	series, ok := metrics.series[labels]
+	if !ok {
+		series = &requestSeries{
+			duration: newHistogram(metrics.Options.LatencyBuckets),
+			size:     newHistogram(metrics.Options.SizeBuckets),
+		}
+		metrics.series[labels] = series
+	}
+	series.count++
+	series.duration.observe(duration.Seconds())
+	series.size.observe(float64(size))
+}
+
+// Handler serves the collected metrics and Go runtime stats.
+func (metrics *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		buf := &bytes.Buffer{}
+		metrics.WriteText(buf)
+		WriteRuntimeMetrics(buf)
+		RespondWith(w, http.StatusOK, MetricsContentType, buf.Bytes())
+	})
+}
+
+// WriteText writes the request metrics in the Prometheus text exposition format.
+func (metrics *Metrics) WriteText(buf *bytes.Buffer) {
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+
+	labelsList := make([]metricsLabels, 0, len(metrics.series))
+	for labels := range metrics.series {
+		labelsList = append(labelsList, labels)
+	}
+	sort.Slice(labelsList, func(i, j int) bool {
+		a, b := labelsList[i], labelsList[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.code < b.code
+	})
+
+	name := metrics.name("http_requests_total")
+	writeMetricHeader(buf, name, "counter", "Total number of HTTP requests.")
+	for _, labels := range labelsList {
+		writeSample(buf, name, labels.pairs(), float64(metrics.series[labels].count))
+	}
+
+	name = metrics.name("http_request_duration_seconds")
+	writeMetricHeader(buf, name, "histogram", "HTTP request latencies in seconds.")
+	for _, labels := range labelsList {
+		writeHistogram(buf, name, labels.pairs(), metrics.series[labels].duration)
+	}
+
+	name = metrics.name("http_response_size_bytes")
+	writeMetricHeader(buf, name, "histogram", "HTTP response sizes in bytes.")
+	for _, labels := range labelsList {
+		writeHistogram(buf, name, labels.pairs(), metrics.series[labels].size)
+	}
+}
+
+func (metrics *Metrics) name(name string) string {
+	if len(metrics.Options.Namespace) > 0 {
+		return metrics.Options.Namespace + "_" + name
+	}
+	return name
+}
+
+func (labels metricsLabels) pairs() []string {
+	return []string{"code", labels.code, "method", labels.method, "route", labels.route}
+}
+
+// WriteRuntimeMetrics writes Go runtime stats in the Prometheus text
+// exposition format, using the same names as the official Go client.
+func WriteRuntimeMetrics(buf *bytes.Buffer) {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	gcStats := debug.GCStats{PauseQuantiles: make([]time.Duration, 5)}
+	debug.ReadGCStats(&gcStats)
+
+	writeMetricHeader(buf, "go_gc_duration_seconds", "summary", "A summary of the GC invocation durations.")
+	for i, quantile := range []string{"0", "0.25", "0.5", "0.75", "1"} {
+		writeSample(buf, "go_gc_duration_seconds", []string{"quantile", quantile}, gcStats.PauseQuantiles[i].Seconds())
+	}
+	writeSample(buf, "go_gc_duration_seconds_sum", nil, gcStats.PauseTotal.Seconds())
+	writeSample(buf, "go_gc_duration_seconds_count", nil, float64(gcStats.NumGC))
+
+	gauges := []struct {
+		name  string
+		kind  string
+		help  string
+		value float64
+	}{
+		{"go_goroutines", "gauge", "Number of goroutines that currently exist.", float64(runtime.NumGoroutine())},
+		{"go_threads", "gauge", "Number of OS threads created.", float64(pprof.Lookup("threadcreate").Count())},
+		{"go_memstats_alloc_bytes", "gauge", "Number of bytes allocated and still in use.", float64(memStats.Alloc)},
+		{"go_memstats_alloc_bytes_total", "counter", "Total number of bytes allocated, even if freed.", float64(memStats.TotalAlloc)},
+		{"go_memstats_sys_bytes", "gauge", "Number of bytes obtained from system.", float64(memStats.Sys)},
+		{"go_memstats_mallocs_total", "counter", "Total number of mallocs.", float64(memStats.Mallocs)},
+		{"go_memstats_frees_total", "counter", "Total number of frees.", float64(memStats.Frees)},
+		{"go_memstats_heap_alloc_bytes", "gauge", "Number of heap bytes allocated and still in use.", float64(memStats.HeapAlloc)},
+		{"go_memstats_heap_sys_bytes", "gauge", "Number of heap bytes obtained from system.", float64(memStats.HeapSys)},
+		{"go_memstats_heap_idle_bytes", "gauge", "Number of heap bytes waiting to be used.", float64(memStats.HeapIdle)},
+		{"go_memstats_heap_inuse_bytes", "gauge", "Number of heap bytes that are in use.", float64(memStats.HeapInuse)},
+		{"go_memstats_heap_released_bytes", "gauge", "Number of heap bytes released to OS.", float64(memStats.HeapReleased)},
+		{"go_memstats_heap_objects", "gauge", "Number of allocated objects.", float64(memStats.HeapObjects)},
+		{"go_memstats_stack_inuse_bytes", "gauge", "Number of bytes in use by the stack allocator.", float64(memStats.StackInuse)},
+		{"go_memstats_next_gc_bytes", "gauge", "Number of heap bytes when next garbage collection will take place.", float64(memStats.NextGC)},
+		{"go_memstats_last_gc_time_seconds", "gauge", "Number of seconds since 1970 of last garbage collection.", float64(memStats.LastGC) / 1e9},
+		{"go_memstats_gc_cpu_fraction", "gauge", "The fraction of this program's available CPU time used by the GC since the program started.", memStats.GCCPUFraction},
+	}
+	for _, gauge := range gauges {
+		writeMetricHeader(buf, gauge.name, gauge.kind, gauge.help)
+		writeSample(buf, gauge.name, nil, gauge.value)
+	}
+
+	writeMetricHeader(buf, "go_info", "gauge", "Information about the Go environment.")
+	writeSample(buf, "go_info", []string{"version", runtime.Version()}, 1)
+}
+
+func writeMetricHeader(buf *bytes.Buffer, name string, kind string, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeSample writes a single sample line, labelPairs alternates label names
+// and values.
+func writeSample(buf *bytes.Buffer, name string, labelPairs []string, value float64) {
+	buf.WriteString(name)
+	if len(labelPairs) > 0 {
+		buf.WriteByte('{')
+		for i := 0; i+1 < len(labelPairs); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(buf, "%s=\"%s\"", labelPairs[i], escapeLabelValue(labelPairs[i+1]))
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(formatMetricValue(value))
+	buf.WriteByte('\n')
+}
+
+func writeHistogram(buf *bytes.Buffer, name string, labelPairs []string, h *histogram) {
+	labelPairs = labelPairs[:len(labelPairs):len(labelPairs)] // NB: Force append to copy.
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		writeSample(buf, name+"_bucket", append(labelPairs, "le", formatMetricValue(bound)), float64(cumulative))
+	}
+	writeSample(buf, name+"_bucket", append(labelPairs, "le", "+Inf"), float64(h.count))
+	writeSample(buf, name+"_sum", labelPairs, h.sum)
+	writeSample(buf, name+"_count", labelPairs, float64(h.count))
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueReplacer.Replace(value)
+}
+
+func formatMetricValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,63 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics(MetricsOptions{Namespace: "test", SizeBuckets: []float64{1, 10}})
+	mux := http.NewServeMux()
+	mux.Handle("/users/", WithRoutePattern("/users/:id", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, "user")
+	})))
+	mux.Handle("/metrics", metrics.Handler())
+	server := NewWebServer(WebServerOptions{Addr: testAddr, Handler: metrics.Middleware(mux)})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := server.Stop(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	for _, path := range []string{"/users/1", "/users/2", "/missing"} {
+		getBody(t, http.DefaultClient, server.BaseUrl()+path)
+	}
+	response, err := http.Get(server.BaseUrl() + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if expected, actual := MetricsContentType, response.Header.Get("Content-Type"); actual != expected {
+		t.Errorf("Expected content-type=%q but actual=%q", expected, actual)
+	}
+
+	body := getBody(t, http.DefaultClient, server.BaseUrl()+"/metrics")
+	expectedLines := []string{
+		"# TYPE test_http_requests_total counter",
+		`test_http_requests_total{code="200",method="GET",route="/users/:id"} 2`,
+		`test_http_requests_total{code="404",method="GET",route="<unmatched>"} 1`,
+		`test_http_response_size_bytes_bucket{code="200",method="GET",route="/users/:id",le="1"} 0`,
+		`test_http_response_size_bytes_bucket{code="200",method="GET",route="/users/:id",le="10"} 2`,
+		`test_http_response_size_bytes_bucket{code="200",method="GET",route="/users/:id",le="+Inf"} 2`,
+		`test_http_response_size_bytes_sum{code="200",method="GET",route="/users/:id"} 8`,
+		`test_http_request_duration_seconds_count{code="200",method="GET",route="/users/:id"} 2`,
+		"# TYPE go_gc_duration_seconds summary",
+		"# TYPE go_goroutines gauge",
+	}
+	for _, line := range expectedLines {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected metrics output to contain line %q but it didn't; output:\n%s", line, body)
+		}
+	}
+}
+
+func TestEscapeLabelValue(t *testing.T) {
+	if expected, actual := `a\\b\"c\nd`, escapeLabelValue("a\\b\"c\nd"); actual != expected {
+		t.Errorf("Expected escaped value=%q but actual=%q", expected, actual)
+	}
+}
@@ -2,14 +2,15 @@ package web
 
 // Mime-types.
 const (
-	MimeHtml       = "text/html"
-	MimeJavascript = "application/javascript" // Should only be used as a response content-type.
-	MimeJson       = "application/json"
-	MimePlain      = "text/plain"
-	MimePostForm   = "application/x-www-form-urlencoded"
-	MimeXml        = "application/xml"
-	MimeXml2       = "text/xml"
-	MimeYaml       = "application/x-yaml"
-	MimeYaml2      = "text/yaml"
-	MimeYaml3      = "text/x-yaml"
+	MimeHtml          = "text/html"
+	MimeJavascript    = "application/javascript" // Should only be used as a response content-type.
+	MimeJson          = "application/json"
+	MimePlain         = "text/plain"
+	MimeMultipartForm = "multipart/form-data"
+	MimePostForm      = "application/x-www-form-urlencoded"
+	MimeXml           = "application/xml"
+	MimeXml2          = "text/xml"
+	MimeYaml          = "application/x-yaml"
+	MimeYaml2         = "text/yaml"
+	MimeYaml3         = "text/x-yaml"
 )
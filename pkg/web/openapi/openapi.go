@@ -0,0 +1,267 @@
+// Package openapi generates OpenAPI 3 documents from route bundles.
+//
+// Routes are documented by their `route.RouteDoc':
+//
+//     route.RouteDatum{
+//         Reciever: "get",
+//         Path:     "/v1/users",
+//         HandlerFunc: listUsers,
+//         Doc: &route.RouteDoc{
+//             Summary:  "List users",
+//             Response: generics.ApiResponse{Objects: []User{}},
+//         },
+//     }
+//
+// and the document is served by appending the bundle produced by `Bundle()':
+//
+//     docs, err := openapi.Bundle(bundles, openapi.Options{Title: "My API", Version: "1.0"})
+//     ...
+//     h, err := route.Activate(append(bundles, docs))
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gigawattio/go-commons/pkg/validation"
+	"github.com/gigawattio/go-commons/pkg/web"
+	"github.com/gigawattio/go-commons/pkg/web/generics"
+	"github.com/gigawattio/go-commons/pkg/web/route"
+)
+
+const (
+	Version = "3.0.0"
+
+	DefaultPath = "/openapi.json"
+)
+
+type Options struct {
+	Title       string
+	Version     string // version of the API.
+	Description string
+	Servers     []string // base URLs of the API.
+	Path        string   // where `Bundle()' serves the document, DefaultPath if empty.
+}
+
+type (
+	Document struct {
+		OpenAPI    string               `json:"openapi"`
+		Info       Info                 `json:"info"`
+		Servers    []Server             `json:"servers,omitempty"`
+		Paths      map[string]*PathItem `json:"paths"`
+		Components Components           `json:"components"`
+	}
+	Info struct {
+		Title       string `json:"title"`
+		Version     string `json:"version"`
+		Description string `json:"description,omitempty"`
+	}
+	Server struct {
+		Url string `json:"url"`
+	}
+	// PathItem maps lower-case methods to operations.
+	PathItem  map[string]*Operation
+	Operation struct {
+		OperationId string               `json:"operationId,omitempty"`
+		Summary     string               `json:"summary,omitempty"`
+		Description string               `json:"description,omitempty"`
+		Tags        []string             `json:"tags,omitempty"`
+		Parameters  []Parameter          `json:"parameters,omitempty"`
+		RequestBody *RequestBody         `json:"requestBody,omitempty"`
+		Responses   map[string]*Response `json:"responses"`
+	}
+	Parameter struct {
+		Name        string  `json:"name"`
+		In          string  `json:"in"`
+		Description string  `json:"description,omitempty"`
+		Required    bool    `json:"required,omitempty"`
+		Schema      *Schema `json:"schema"`
+	}
+	RequestBody struct {
+		Required bool                  `json:"required"`
+		Content  map[string]*MediaType `json:"content"`
+	}
+	Response struct {
+		Description string                `json:"description"`
+		Content     map[string]*MediaType `json:"content,omitempty"`
+	}
+	MediaType struct {
+		Schema *Schema `json:"schema"`
+	}
+	Components struct {
+		Schemas map[string]*Schema `json:"schemas,omitempty"`
+	}
+)
+
+// Error documents the error bodies produced by `web.JsonErrorFor()'.
+type Error struct {
+	Error     string                  `json:"error"`
+	Fields    []validation.FieldError `json:"fields,omitempty"`
+	RequestId string                  `json:"request_id,omitempty"`
+}
+
+// Generate produces the document for the routes of rmbs.  Routes without a
+// `Doc' are included with default responses; mounts, automatic routes and HEAD
+// and OPTIONS routes are omitted.
+func Generate(rmbs []route.RouteMiddlewareBundle, options Options) (*Document, error) {
+	routes, err := route.Routes(rmbs)
+	if err != nil {
+		return nil, err
+	}
+	doc := &Document{
+		OpenAPI: Version,
+		Info: Info{
+			Title:       options.Title,
+			Version:     options.Version,
+			Description: options.Description,
+		},
+		Paths: map[string]*PathItem{},
+	}
+	for _, server := range options.Servers {
+		doc.Servers = append(doc.Servers, Server{Url: server})
+	}
+	s := newSchemas()
+	for _, info := range routes {
+		if info.Automatic || info.Mount || info.Method == "HEAD" || info.Method == "OPTIONS" {
+			continue
+		}
+		path, params := convertPath(info.Path)
+		item, ok := doc.Paths[path]
+		if !ok {
+			item = &PathItem{}
+			doc.Paths[path] = item
+		}
+		method := strings.ToLower(info.Method)
+		if _, ok := (*item)[method]; ok {
+			return nil, fmt.Errorf("openapi: duplicate operation method=%s path=%v", info.Method, path)
+		}
+		(*item)[method] = operation(s, info, params)
+	}
+	doc.Components.Schemas = s.components
+	return doc, nil
+}
+
+// Bundle produces a RouteMiddlewareBundle serving the document for rmbs at
+// `options.Path'.  The document is generated once, up front.
+func Bundle(rmbs []route.RouteMiddlewareBundle, options Options) (route.RouteMiddlewareBundle, error) {
+	doc, err := Generate(rmbs, options)
+	if err != nil {
+		return route.RouteMiddlewareBundle{}, err
+	}
+	if len(options.Path) == 0 {
+		options.Path = DefaultPath
+	}
+	bundle := route.RouteMiddlewareBundle{
+		RouteData: []route.RouteDatum{
+			{Reciever: "get", Path: options.Path, HandlerFunc: Handler(doc).ServeHTTP},
+		},
+	}
+	return bundle, nil
+}
+
+// Handler serves doc as JSON.
+func Handler(doc *Document) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		web.RespondWithJson(w, http.StatusOK, doc)
+	})
+}
+
+func operation(s *schemas, info route.RouteInfo, pathParams []string) *Operation {
+	doc := info.Doc
+	if doc == nil {
+		doc = &route.RouteDoc{}
+	}
+	op := &Operation{
+		OperationId: info.Name,
+		Summary:     doc.Summary,
+		Description: doc.Description,
+		Tags:        doc.Tags,
+		Responses:   map[string]*Response{},
+	}
+	for _, name := range pathParams {
+		param := Parameter{Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"}}
+		for _, paramDoc := range doc.PathParams {
+			if paramDoc.Name == name {
+				param.Description = paramDoc.Description
+				param.Schema = paramSchema(paramDoc)
+			}
+		}
+		op.Parameters = append(op.Parameters, param)
+	}
+	queryParams := doc.QueryParams
+	if isListing(doc.Response) {
+		// Parsed by `generics.GenericObjectsEndpoint()'.
+		queryParams = append([]route.ParamDoc{
+			{Name: "limit", Type: "integer", Description: "Maximum number of objects to return."},
+			{Name: "offset", Type: "integer", Description: "Number of objects to skip."},
+		}, queryParams...)
+	}
+	for _, paramDoc := range queryParams {
+		param := Parameter{
+			Name:        paramDoc.Name,
+			In:          "query",
+			Description: paramDoc.Description,
+			Required:    paramDoc.Required,
+			Schema:      paramSchema(paramDoc),
+		}
+		op.Parameters = append(op.Parameters, param)
+	}
+	if doc.Request != nil {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]*MediaType{web.MimeJson: {Schema: s.of(doc.Request)}},
+		}
+	}
+	statuses := doc.Statuses
+	if len(statuses) == 0 {
+		if info.Method == "POST" {
+			statuses = []int{http.StatusCreated}
+		} else {
+			statuses = []int{http.StatusOK}
+		}
+	}
+	for _, status := range statuses {
+		response := &Response{Description: http.StatusText(status)}
+		switch {
+		case status >= 400:
+			response.Content = map[string]*MediaType{web.MimeJson: {Schema: s.of(Error{})}}
+		case status != http.StatusNoContent && doc.Response != nil:
+			response.Content = map[string]*MediaType{web.MimeJson: {Schema: s.of(doc.Response)}}
+		}
+		op.Responses[strconv.Itoa(status)] = response
+	}
+	return op
+}
+
+func paramSchema(paramDoc route.ParamDoc) *Schema {
+	if len(paramDoc.Type) == 0 {
+		return &Schema{Type: "string"}
+	}
+	return &Schema{Type: paramDoc.Type}
+}
+
+func isListing(response interface{}) bool {
+	switch response.(type) {
+	case generics.ApiResponse, *generics.ApiResponse:
+		return true
+	}
+	return false
+}
+
+// convertPath converts an httprouter path to an OpenAPI one, e.g.
+// "/users/:id" to "/users/{id}", returning the parameter names.
+func convertPath(path string) (string, []string) {
+	var (
+		segments = strings.Split(path, "/")
+		params   = []string{}
+	)
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			params = append(params, segment[1:])
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
@@ -0,0 +1,188 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gigawattio/go-commons/pkg/web/generics"
+	"github.com/gigawattio/go-commons/pkg/web/openapi"
+	"github.com/gigawattio/go-commons/pkg/web/route"
+)
+
+type Address struct {
+	City string `json:"city"`
+}
+
+type User struct {
+	Id        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email,omitempty"`
+	Password  string    `json:"-"`
+	Created   time.Time `json:"created"`
+	Address   *Address  `json:"address"`
+	Tags      []string  `json:"tags"`
+	Friends   []User    `json:"friends,omitempty"`
+	internal  bool
+	Timestamp int64 `json:",string"`
+}
+
+// Node is recursive and, having an interface field, is reflected over per
+// value.
+type Node struct {
+	Value    interface{} `json:"value"`
+	Children []Node      `json:"children"`
+}
+
+func genBundles() []route.RouteMiddlewareBundle {
+	ok := func(w http.ResponseWriter, req *http.Request) {}
+	return []route.RouteMiddlewareBundle{
+		route.RouteMiddlewareBundle{
+			Prefix: "/v1",
+			RouteData: []route.RouteDatum{
+				{Name: "list-users", Reciever: "get", Path: "/users", HandlerFunc: ok, Doc: &route.RouteDoc{
+					Summary:  "List users",
+					Tags:     []string{"users"},
+					Response: generics.ApiResponse{Objects: []User{}},
+				}},
+				{Reciever: "post", Path: "/users", HandlerFunc: ok, Doc: &route.RouteDoc{
+					Request:  User{},
+					Response: User{},
+					Statuses: []int{http.StatusCreated, http.StatusUnprocessableEntity},
+				}},
+				{Reciever: "get", Path: "/users/:id", HandlerFunc: ok, Doc: &route.RouteDoc{
+					PathParams:  []route.ParamDoc{{Name: "id", Type: "integer", Description: "User ID"}},
+					QueryParams: []route.ParamDoc{{Name: "expand", Required: true}},
+					Response:    &User{},
+				}},
+				{Reciever: "delete", Path: "/users/:id", HandlerFunc: ok},
+			},
+			Mounts: []route.Mount{
+				{Prefix: "/static", Handler: http.NotFoundHandler()},
+			},
+		},
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	doc, err := openapi.Generate(genBundles(), openapi.Options{Title: "Test API", Version: "1.2.3", Servers: []string{"https://api.example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var generic map[string]interface{}
+	if err := json.Unmarshal(encoded, &generic); err != nil {
+		t.Fatal(err)
+	}
+	lookup := func(keys ...interface{}) interface{} {
+		var v interface{} = generic
+		for _, key := range keys {
+			switch k := key.(type) {
+			case string:
+				m, ok := v.(map[string]interface{})
+				if !ok {
+					return nil
+				}
+				v = m[k]
+			case int:
+				a, ok := v.([]interface{})
+				if !ok || k >= len(a) {
+					return nil
+				}
+				v = a[k]
+			}
+		}
+		return v
+	}
+
+	testCases := []struct {
+		keys     []interface{}
+		expected interface{}
+	}{
+		{[]interface{}{"openapi"}, "3.0.0"},
+		{[]interface{}{"info", "title"}, "Test API"},
+		{[]interface{}{"servers", 0, "url"}, "https://api.example.com"},
+		{[]interface{}{"paths", "/v1/users", "get", "operationId"}, "list-users"},
+		{[]interface{}{"paths", "/v1/users", "get", "parameters", 0, "name"}, "limit"},
+		{[]interface{}{"paths", "/v1/users", "get", "responses", "200", "content", "application/json", "schema", "properties", "objects", "items", "$ref"}, "#/components/schemas/User"},
+		{[]interface{}{"paths", "/v1/users", "get", "responses", "200", "content", "application/json", "schema", "properties", "meta", "$ref"}, "#/components/schemas/ApiMeta"},
+		{[]interface{}{"paths", "/v1/users", "post", "requestBody", "content", "application/json", "schema", "$ref"}, "#/components/schemas/User"},
+		{[]interface{}{"paths", "/v1/users", "post", "responses", "422", "content", "application/json", "schema", "$ref"}, "#/components/schemas/Error"},
+		{[]interface{}{"paths", "/v1/users/{id}", "get", "parameters", 0, "schema", "type"}, "integer"},
+		{[]interface{}{"paths", "/v1/users/{id}", "get", "parameters", 1, "in"}, "query"},
+		{[]interface{}{"paths", "/v1/users/{id}", "get", "parameters", 1, "required"}, true},
+		{[]interface{}{"paths", "/v1/users/{id}", "delete", "responses", "200", "description"}, "OK"},
+		{[]interface{}{"paths", "/v1/users/{id}", "head"}, nil},
+		{[]interface{}{"paths", "/v1/static/{path}"}, nil},
+		{[]interface{}{"components", "schemas", "User", "properties", "created", "format"}, "date-time"},
+		{[]interface{}{"components", "schemas", "User", "properties", "address", "$ref"}, "#/components/schemas/Address"},
+		{[]interface{}{"components", "schemas", "User", "properties", "tags", "items", "type"}, "string"},
+		{[]interface{}{"components", "schemas", "User", "properties", "friends", "items", "$ref"}, "#/components/schemas/User"},
+		{[]interface{}{"components", "schemas", "User", "properties", "Timestamp", "type"}, "string"},
+		{[]interface{}{"components", "schemas", "User", "properties", "Password"}, nil},
+		{[]interface{}{"components", "schemas", "User", "properties", "internal"}, nil},
+		{[]interface{}{"components", "schemas", "User", "required"}, []interface{}{"id", "name", "created", "tags", "Timestamp"}},
+	}
+	for i, testCase := range testCases {
+		expected, _ := json.Marshal(testCase.expected)
+		actual, _ := json.Marshal(lookup(testCase.keys...))
+		if string(actual) != string(expected) {
+			t.Errorf("[i=%v] Expected %v=%s but actual=%s", i, testCase.keys, expected, actual)
+		}
+	}
+}
+
+func TestGenerateRecursive(t *testing.T) {
+	ok := func(w http.ResponseWriter, req *http.Request) {}
+	bundles := []route.RouteMiddlewareBundle{
+		route.RouteMiddlewareBundle{
+			RouteData: []route.RouteDatum{
+				{Reciever: "get", Path: "/tree", HandlerFunc: ok, Doc: &route.RouteDoc{
+					Response: Node{Value: "root", Children: []Node{{Value: int64(1)}}},
+				}},
+			},
+		},
+	}
+	doc, err := openapi.Generate(bundles, openapi.Options{Title: "Test API"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := (*doc.Paths["/tree"])["get"].Responses["200"].Content["application/json"].Schema
+	if expected, actual := "string", schema.Properties["value"].Type; actual != expected {
+		t.Errorf("Expected inlined value type=%q but actual=%q", expected, actual)
+	}
+	if expected, actual := "#/components/schemas/Node", schema.Properties["children"].Items.Ref; actual != expected {
+		t.Errorf("Expected children items $ref=%q but actual=%q", expected, actual)
+	}
+	if expected, actual := "#/components/schemas/Node", doc.Components.Schemas["Node"].Properties["children"].Items.Ref; actual != expected {
+		t.Errorf("Expected component children items $ref=%q but actual=%q", expected, actual)
+	}
+}
+
+func TestBundle(t *testing.T) {
+	bundle, err := openapi.Bundle(genBundles(), openapi.Options{Title: "Test API", Path: "/docs/openapi.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := route.Activate(append(genBundles(), bundle))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	h.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/docs/openapi.json", nil))
+	if expected, actual := http.StatusOK, rec.Code; actual != expected {
+		t.Fatalf("Expected status-code=%v but actual=%v", expected, actual)
+	}
+	doc := openapi.Document{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 2, len(doc.Paths); actual != expected {
+		t.Errorf("Expected number of paths=%v but actual=%v", expected, actual)
+	}
+}
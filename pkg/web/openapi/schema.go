@@ -0,0 +1,214 @@
+package openapi
+
+import (
+	"path"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema is an OpenAPI schema object.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	byteType = reflect.TypeOf(byte(0))
+)
+
+// schemas reflects over Go values to produce schemas, collecting named struct
+// types as reusable components.
+type schemas struct {
+	components map[string]*Schema
+	names      map[reflect.Type]string
+	inlining   map[reflect.Type]bool // struct types whose inline schemas are in progress.
+}
+
+func newSchemas() *schemas {
+	s := &schemas{
+		components: map[string]*Schema{},
+		names:      map[reflect.Type]string{},
+		inlining:   map[reflect.Type]bool{},
+	}
+	return s
+}
+
+// of produces the schema of value.  The dynamic values of interface fields are
+// reflected over too, so e.g. `generics.ApiResponse{Objects: []User{}}' is
+// described as an envelope of users.
+func (s *schemas) of(value interface{}) *Schema {
+	if value == nil {
+		return &Schema{}
+	}
+	return s.ofValue(reflect.ValueOf(value))
+}
+
+func (s *schemas) ofValue(value reflect.Value) *Schema {
+	if value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return &Schema{}
+		}
+		return s.ofValue(value.Elem())
+	}
+	t := value.Type()
+	if value.Kind() == reflect.Ptr {
+		var schema *Schema
+		if value.IsNil() {
+			schema = s.ofValue(reflect.Zero(t.Elem()))
+		} else {
+			schema = s.ofValue(value.Elem())
+		}
+		if len(schema.Ref) == 0 {
+			schema.Nullable = true
+		}
+		return schema
+	}
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem() == byteType:
+		return &Schema{Type: "string", Format: "byte"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		var items *Schema
+		if value.Len() > 0 {
+			items = s.ofValue(value.Index(0))
+		} else {
+			items = s.ofValue(reflect.Zero(t.Elem()))
+		}
+		return &Schema{Type: "array", Items: items}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.ofValue(reflect.Zero(t.Elem()))}
+	case reflect.Struct:
+		return s.ofStruct(value)
+	}
+	return &Schema{}
+}
+
+// ofStruct describes named structs by reference to a component.  Structs with
+// interface fields are reflected over per value, so they're inlined instead,
+// unless they recursively contain themselves, in which case the nested
+// occurrences refer to a component.
+func (s *schemas) ofStruct(value reflect.Value) *Schema {
+	t := value.Type()
+	if (len(t.Name()) == 0 || hasInterfaceField(t)) && !s.inlining[t] {
+		s.inlining[t] = true
+		defer delete(s.inlining, t)
+		return s.structSchema(value)
+	}
+	if name, ok := s.names[t]; ok {
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	name := s.componentName(t)
+	s.names[t] = name
+	// NB: Registered before reflecting over the fields so recursive types
+	// terminate.
+	s.components[name] = &Schema{}
+	*s.components[name] = *s.structSchema(reflect.Zero(t))
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// componentName is the type's name, qualified by its package when another type
+// already has it.
+func (s *schemas) componentName(t reflect.Type) string {
+	name := t.Name()
+	if _, taken := s.components[name]; taken {
+		name = path.Base(t.PkgPath()) + "." + name
+	}
+	return name
+}
+
+func (s *schemas) structSchema(value reflect.Value) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	s.addFields(schema, value)
+	return schema
+}
+
+// addFields adds the fields of the struct value to schema, following the
+// encoding/json rules for names, omission and embedding.
+func (s *schemas) addFields(schema *Schema, value reflect.Value) {
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		var (
+			pieces    = strings.Split(tag, ",")
+			name      = pieces[0]
+			omitEmpty bool
+			asString  bool
+		)
+		for _, option := range pieces[1:] {
+			switch option {
+			case "omitempty":
+				omitEmpty = true
+			case "string":
+				asString = true
+			}
+		}
+		if field.Anonymous && len(name) == 0 {
+			embedded := value.Field(i)
+			if embedded.Kind() == reflect.Ptr {
+				embedded = reflect.Zero(field.Type.Elem())
+			}
+			if embedded.Kind() == reflect.Struct {
+				s.addFields(schema, embedded)
+				continue
+			}
+		}
+		if len(field.PkgPath) > 0 {
+			// Unexported.
+			continue
+		}
+		if len(name) == 0 {
+			name = field.Name
+		}
+		var fieldSchema *Schema
+		if asString {
+			fieldSchema = &Schema{Type: "string"}
+		} else {
+			fieldSchema = s.ofValue(value.Field(i))
+		}
+		schema.Properties[name] = fieldSchema
+		if !omitEmpty && field.Type.Kind() != reflect.Ptr {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+func hasInterfaceField(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Type.Kind() == reflect.Interface {
+			return true
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && hasInterfaceField(field.Type) {
+			return true
+		}
+	}
+	return false
+}
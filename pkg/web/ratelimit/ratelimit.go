@@ -0,0 +1,275 @@
+// Package ratelimit provides HTTP rate limiting middleware backed by pluggable
+// stores.
+//
+// Example usage:
+//
+//     limiter, err := ratelimit.New(ratelimit.Options{
+//         Algorithm: ratelimit.SlidingWindow,
+//         Requests:  100,
+//         Period:    time.Minute,
+//         KeyFunc:   ratelimit.UserKey(cookieAuth.Read, ratelimit.ClientIpKey(nil)),
+//     })
+//     ...
+//     route.RouteMiddlewareBundle{
+//         Middlewares: []func(http.Handler) http.Handler{limiter.Middleware},
+//         ...
+//     }
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gigawattio/go-commons/pkg/web"
+)
+
+type Algorithm int
+
+const (
+	// TokenBucket permits bursts of up to `Options.Burst' requests, refilling
+	// at `Options.Requests' per `Options.Period'.
+	TokenBucket Algorithm = iota
+
+	// SlidingWindow permits `Options.Requests' per `Options.Period', estimating
+	// the rolling count from the current and previous fixed windows.
+	SlidingWindow
+)
+
+// KeyFunc identifies the client a request is counted against.  Requests for
+// which the empty string is returned are not limited.
+type KeyFunc func(req *http.Request) string
+
+type Options struct {
+	Algorithm Algorithm
+	Requests  int64         // requests permitted per Period.
+	Period    time.Duration // length of the window (SlidingWindow) or full refill (TokenBucket).
+	Burst     int64         // TokenBucket capacity, Requests if 0.
+	Store     Store         // NewMemoryStore() if nil.
+	KeyFunc   KeyFunc       // ClientIpKey(nil) if nil.
+}
+
+// Result is the outcome of a rate limit check.
+type Result struct {
+	Allowed    bool
+	Limit      int64
+	Remaining  int64
+	Reset      time.Duration // until the limit is fully replenished (TokenBucket) or the window ends (SlidingWindow).
+	RetryAfter time.Duration // until a request will next be permitted, 0 when Allowed.
+}
+
+var ExceededError = errors.New("rate limit exceeded")
+
+// Limiter enforces a rate limit per key.
+type Limiter struct {
+	Options Options
+}
+
+func New(options Options) (*Limiter, error) {
+	if options.Requests <= 0 {
+		return nil, errors.New("ratelimit: Requests must be positive")
+	}
+	if options.Period <= 0 {
+		return nil, errors.New("ratelimit: Period must be positive")
+	}
+	if options.Burst <= 0 {
+		options.Burst = options.Requests
+	}
+	if options.Store == nil {
+		options.Store = NewMemoryStore()
+	}
+	if options.KeyFunc == nil {
+		options.KeyFunc = ClientIpKey(nil)
+	}
+	limiter := &Limiter{
+		Options: options,
+	}
+	return limiter, nil
+}
+
+// Allow counts a request against key.
+func (limiter *Limiter) Allow(key string) (result Result, err error) {
+	now := time.Now()
+	err = limiter.Options.Store.Update(key, limiter.ttl(), func(state State) State {
+		// NB: May be invoked more than once, so result is simply overwritten.
+		switch limiter.Options.Algorithm {
+		case SlidingWindow:
+			state, result = limiter.slidingWindow(state, now)
+		default:
+			state, result = limiter.tokenBucket(state, now)
+		}
+		return state
+	})
+	if err != nil {
+		err = fmt.Errorf("ratelimit: updating key=%q: %s", key, err)
+	}
+	return
+}
+
+// Middleware responds with 429 Too Many Requests once a client exceeds the
+// limit, and otherwise adds RateLimit-* headers to the response.  Should the
+// store fail the request is let through.
+func (limiter *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		key := limiter.Options.KeyFunc(req)
+		if len(key) == 0 {
+			next.ServeHTTP(w, req)
+			return
+		}
+		result, err := limiter.Allow(key)
+		if err != nil {
+			web.RequestLogger(req).Errorf("%s, permitting request", err)
+			next.ServeHTTP(w, req)
+			return
+		}
+		header := w.Header()
+		header.Set("RateLimit-Limit", strconv.FormatInt(result.Limit, 10))
+		header.Set("RateLimit-Remaining", strconv.FormatInt(result.Remaining, 10))
+		header.Set("RateLimit-Reset", strconv.FormatInt(ceilSeconds(result.Reset), 10))
+		if !result.Allowed {
+			retryAfter := ceilSeconds(result.RetryAfter)
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			header.Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+			body := web.Json{"error": ExceededError.Error()}
+			if requestId := web.RequestId(req); len(requestId) > 0 {
+				body["request_id"] = requestId
+			}
+			web.RespondWithJson(w, http.StatusTooManyRequests, body)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// ttl is how long state must be kept for it to matter.
+func (limiter *Limiter) ttl() time.Duration {
+	if limiter.Options.Algorithm == SlidingWindow {
+		return 2 * limiter.Options.Period
+	}
+	return time.Duration(float64(limiter.Options.Burst) / limiter.refillRate() * float64(time.Second))
+}
+
+// refillRate is the TokenBucket refill rate in tokens per second.
+func (limiter *Limiter) refillRate() float64 {
+	return float64(limiter.Options.Requests) / limiter.Options.Period.Seconds()
+}
+
+func (limiter *Limiter) tokenBucket(state State, now time.Time) (State, Result) {
+	var (
+		capacity = float64(limiter.Options.Burst)
+		rate     = limiter.refillRate()
+		tokens   = capacity
+	)
+	if !state.Stamp.IsZero() {
+		elapsed := now.Sub(state.Stamp).Seconds()
+		if elapsed < 0 {
+			elapsed = 0
+		}
+		tokens = math.Min(capacity, state.Level+elapsed*rate)
+	}
+	result := Result{Limit: limiter.Options.Burst}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	result.Remaining = int64(math.Floor(tokens))
+	result.Reset = seconds((capacity - tokens) / rate)
+	return State{Level: tokens, Stamp: now}, result
+}
+
+func (limiter *Limiter) slidingWindow(state State, now time.Time) (State, Result) {
+	var (
+		period      = limiter.Options.Period
+		limit       = float64(limiter.Options.Requests)
+		windowStart = now.Truncate(period)
+	)
+	if !state.Stamp.Equal(windowStart) {
+		if state.Stamp.Equal(windowStart.Add(-period)) {
+			state.PrevLevel = state.Level
+		} else {
+			state.PrevLevel = 0
+		}
+		state.Level = 0
+		state.Stamp = windowStart
+	}
+	var (
+		elapsed  = now.Sub(windowStart)
+		fraction = float64(elapsed) / float64(period)
+		estimate = state.PrevLevel*(1-fraction) + state.Level
+		result   = Result{Limit: limiter.Options.Requests, Reset: period - elapsed}
+	)
+	if estimate+1 <= limit {
+		state.Level++
+		estimate++
+		result.Allowed = true
+	} else if state.PrevLevel > 0 && state.Level+1 <= limit {
+		// Wait for enough of the previous window to slide out.
+		needed := 1 - (limit-1-state.Level)/state.PrevLevel
+		result.RetryAfter = time.Duration(needed*float64(period)) - elapsed
+	} else {
+		result.RetryAfter = result.Reset
+	}
+	result.Remaining = int64(math.Max(0, math.Floor(limit-estimate)))
+	return state, result
+}
+
+// ClientIpKey keys requests by client IP, honouring forwarding headers from
+// trustedProxies (see `web.ParseTrustedProxies()').
+func ClientIpKey(trustedProxies []*net.IPNet) KeyFunc {
+	return func(req *http.Request) string {
+		return "ip:" + web.ClientIp(req, trustedProxies)
+	}
+}
+
+// UserKey keys requests by the authenticated user ID produced by userIdFunc
+// (e.g. `cookieAuth.Read'), falling back to fallback for anonymous requests.
+// When fallback is nil anonymous requests are not limited.
+func UserKey(userIdFunc func(req *http.Request) (int64, error), fallback KeyFunc) KeyFunc {
+	return func(req *http.Request) string {
+		if userId, err := userIdFunc(req); err == nil && userId != 0 {
+			return "user:" + strconv.FormatInt(userId, 10)
+		} else if err != nil {
+			log.Debugf("ratelimit: user ID lookup failed: %s", err)
+		}
+		if fallback != nil {
+			return fallback(req)
+		}
+		return ""
+	}
+}
+
+// BasicAuthUserKey keys requests by HTTP basic auth username (see the `auth'
+// package), falling back to fallback for requests without credentials.  When
+// fallback is nil such requests are not limited.
+func BasicAuthUserKey(fallback KeyFunc) KeyFunc {
+	return func(req *http.Request) string {
+		if username, _, ok := req.BasicAuth(); ok && len(username) > 0 {
+			return "user:" + username
+		}
+		if fallback != nil {
+			return fallback(req)
+		}
+		return ""
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// ceilSeconds rounds d up to whole seconds, as header values are in seconds.
+func ceilSeconds(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64(math.Ceil(d.Seconds()))
+}
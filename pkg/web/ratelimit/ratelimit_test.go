@@ -0,0 +1,237 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gigawattio/go-commons/pkg/driver/repository"
+	"github.com/gigawattio/go-commons/pkg/errorlib"
+)
+
+func TestTokenBucket(t *testing.T) {
+	limiter, err := New(Options{Algorithm: TokenBucket, Requests: 1, Period: 50 * time.Millisecond, Burst: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		result, err := limiter.Allow("a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Allowed {
+			t.Fatalf("Expected request #%v within burst to be allowed", i)
+		}
+		if expected, actual := int64(2-i), result.Remaining; actual != expected {
+			t.Errorf("Expected remaining=%v after request #%v but actual=%v", expected, i, actual)
+		}
+	}
+	result, err := limiter.Allow("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Allowed {
+		t.Fatal("Expected request beyond burst to be denied")
+	}
+	if result.RetryAfter <= 0 || result.RetryAfter > 50*time.Millisecond {
+		t.Errorf("Expected 0 < RetryAfter <= 50ms but actual=%v", result.RetryAfter)
+	}
+	if result, _ := limiter.Allow("b"); !result.Allowed {
+		t.Error("Expected a different key to have its own bucket")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if result, _ := limiter.Allow("a"); !result.Allowed {
+		t.Error("Expected a request to be allowed once a token was refilled")
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	limiter, err := New(Options{Algorithm: SlidingWindow, Requests: 5, Period: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if result, _ := limiter.Allow("a"); !result.Allowed {
+			t.Fatalf("Expected request #%v within limit to be allowed", i)
+		}
+	}
+	result, _ := limiter.Allow("a")
+	if result.Allowed {
+		t.Fatal("Expected request beyond limit to be denied")
+	}
+	if expected, actual := int64(0), result.Remaining; actual != expected {
+		t.Errorf("Expected remaining=%v but actual=%v", expected, actual)
+	}
+
+	// Half way through the next window half of the previous window's requests
+	// still count.
+	windowStart := time.Now().Truncate(time.Hour)
+	state, result := limiter.slidingWindow(State{Level: 4, Stamp: windowStart}, windowStart.Add(90*time.Minute))
+	if !result.Allowed {
+		t.Error("Expected request to be allowed with an estimated count of 2")
+	}
+	if expected, actual := float64(4), state.PrevLevel; actual != expected {
+		t.Errorf("Expected previous window count=%v but actual=%v", expected, actual)
+	}
+	if expected, actual := int64(2), result.Remaining; actual != expected {
+		t.Errorf("Expected remaining=%v but actual=%v", expected, actual)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	limiter, err := New(Options{Requests: 1, Period: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+
+	do := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	w := do("192.0.2.1:1000")
+	if expected, actual := http.StatusOK, w.Code; actual != expected {
+		t.Errorf("Expected status-code=%v but actual=%v", expected, actual)
+	}
+	if expected, actual := "1", w.Header().Get("RateLimit-Limit"); actual != expected {
+		t.Errorf("Expected RateLimit-Limit=%v but actual=%v", expected, actual)
+	}
+	if expected, actual := "0", w.Header().Get("RateLimit-Remaining"); actual != expected {
+		t.Errorf("Expected RateLimit-Remaining=%v but actual=%v", expected, actual)
+	}
+
+	w = do("192.0.2.1:1001")
+	if expected, actual := http.StatusTooManyRequests, w.Code; actual != expected {
+		t.Errorf("Expected status-code=%v but actual=%v", expected, actual)
+	}
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter != "60" && retryAfter != "59" {
+		t.Errorf("Expected Retry-After of about 60 seconds but actual=%q", retryAfter)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := ExceededError.Error(), body["error"]; actual != expected {
+		t.Errorf("Expected error=%v but actual=%v", expected, actual)
+	}
+
+	if expected, actual := http.StatusOK, do("192.0.2.2:1000").Code; actual != expected {
+		t.Errorf("Expected a different client IP to be allowed but status-code=%v", actual)
+	}
+}
+
+func TestUserKey(t *testing.T) {
+	keyFunc := UserKey(func(req *http.Request) (int64, error) {
+		if req.Header.Get("X-User") == "42" {
+			return 42, nil
+		}
+		return 0, nil
+	}, ClientIpKey(nil))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.1:1000"
+	if expected, actual := "ip:192.0.2.1", keyFunc(req); actual != expected {
+		t.Errorf("Expected anonymous key=%v but actual=%v", expected, actual)
+	}
+	req.Header.Set("X-User", "42")
+	if expected, actual := "user:42", keyFunc(req); actual != expected {
+		t.Errorf("Expected authenticated key=%v but actual=%v", expected, actual)
+	}
+}
+
+// fakeDriver emulates the subset of a RepositoryDriver used by
+// RepositoryStore, optionally injecting a concurrent update.
+type fakeDriver struct {
+	repository.RepositoryDriver
+	rows      map[string]RateLimitRecord
+	interfere int // Number of upcoming updates to bump the version ahead of.
+	lock      sync.Mutex
+}
+
+func (driver *fakeDriver) TableName(_ interface{}) string { return "rate_limits" }
+
+func (driver *fakeDriver) GetOrCreate(value interface{}) (bool, error) {
+	driver.lock.Lock()
+	defer driver.lock.Unlock()
+	record := value.(*RateLimitRecord)
+	if existing, ok := driver.rows[record.Id]; ok {
+		*record = existing
+		return false, nil
+	}
+	driver.rows[record.Id] = *record
+	return true, nil
+}
+
+func (driver *fakeDriver) Exec(query string, args ...interface{}) error {
+	driver.lock.Lock()
+	defer driver.lock.Unlock()
+	if !strings.HasPrefix(query, "UPDATE rate_limits") {
+		return nil
+	}
+	id := args[6].(string)
+	row := driver.rows[id]
+	if driver.interfere > 0 {
+		driver.interfere--
+		row.Version++
+		row.Nonce = "someone-else"
+		driver.rows[id] = row
+	}
+	if row.Version != args[7].(int64) {
+		return nil
+	}
+	driver.rows[id] = RateLimitRecord{
+		Id:        id,
+		Level:     args[0].(float64),
+		PrevLevel: args[1].(float64),
+		Stamp:     args[2].(time.Time),
+		Version:   args[3].(int64),
+		Nonce:     args[4].(string),
+		ExpiresAt: args[5].(time.Time),
+	}
+	return nil
+}
+
+func (driver *fakeDriver) FirstWhere(value interface{}, _ interface{}, args ...interface{}) error {
+	driver.lock.Lock()
+	defer driver.lock.Unlock()
+	row, ok := driver.rows[args[0].(string)]
+	if !ok || row.Version != args[1].(int64) {
+		return errorlib.NotFoundError
+	}
+	*value.(*RateLimitRecord) = row
+	return nil
+}
+
+func TestRepositoryStore(t *testing.T) {
+	driver := &fakeDriver{rows: map[string]RateLimitRecord{}}
+	limiter, err := New(Options{Requests: 2, Period: time.Minute, Store: NewRepositoryStore(driver)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	driver.interfere = 3 // Lose the race a few times before succeeding.
+	for i := 0; i < 2; i++ {
+		result, err := limiter.Allow("a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Allowed {
+			t.Fatalf("Expected request #%v within limit to be allowed", i)
+		}
+	}
+	if result, _ := limiter.Allow("a"); result.Allowed {
+		t.Error("Expected request beyond limit to be denied")
+	}
+
+	driver.interfere = MaxUpdateAttempts
+	if _, err := limiter.Allow("b"); err == nil {
+		t.Error("Expected persistently conflicting updates to produce an error")
+	}
+}
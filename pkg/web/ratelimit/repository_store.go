@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gigawattio/go-commons/pkg/driver/repository"
+)
+
+// MaxUpdateAttempts bounds how many times RepositoryStore retries an update
+// which lost a race against another instance.
+var MaxUpdateAttempts = 10
+
+var ConflictError = errors.New("too many conflicting concurrent updates")
+
+// RateLimitRecord is the model persisted by RepositoryStore.  It must be
+// included in the application's migrations.
+type RateLimitRecord struct {
+	Id        string    `gorm:"primary_key;type:varchar(255);"`
+	Level     float64   `gorm:"not null;"`
+	PrevLevel float64   `gorm:"not null;"`
+	Stamp     time.Time `gorm:"not null;"`
+	Version   int64     `gorm:"not null;"`
+	Nonce     string    `gorm:"type:varchar(32);not null;"`
+	ExpiresAt time.Time `gorm:"not null;index;"`
+}
+
+func (RateLimitRecord) TableName() string {
+	return "rate_limits"
+}
+
+// RepositoryStore keeps state in a database shared by all instances of a
+// service, so limits are enforced across them.
+//
+// Updates use optimistic concurrency: the row is read, the new state computed
+// and written back only if the row's version is unchanged, otherwise the
+// update is retried.
+type RepositoryStore struct {
+	Driver repository.RepositoryDriver
+}
+
+func NewRepositoryStore(driver repository.RepositoryDriver) *RepositoryStore {
+	store := &RepositoryStore{
+		Driver: driver,
+	}
+	return store
+}
+
+func (store *RepositoryStore) Update(key string, ttl time.Duration, fn func(state State) State) error {
+	var (
+		table   = store.Driver.TableName(&RateLimitRecord{})
+		lastErr error
+	)
+	for attempt := 0; attempt < MaxUpdateAttempts; attempt++ {
+		record := &RateLimitRecord{Id: key}
+		if _, lastErr = store.Driver.GetOrCreate(record); lastErr != nil {
+			// NB: Most likely another instance created the row first.
+			continue
+		}
+		lastErr = nil
+
+		now := time.Now()
+		state := State{}
+		if now.Before(record.ExpiresAt) {
+			state = State{Level: record.Level, PrevLevel: record.PrevLevel, Stamp: record.Stamp}
+		}
+		state = fn(state)
+
+		nonce, err := newNonce()
+		if err != nil {
+			return err
+		}
+		query := fmt.Sprintf(
+			`UPDATE %s SET level = ?, prev_level = ?, stamp = ?, version = ?, nonce = ?, expires_at = ? WHERE id = ? AND version = ?`,
+			table,
+		)
+		if err := store.Driver.Exec(query, state.Level, state.PrevLevel, state.Stamp, record.Version+1, nonce, now.Add(ttl), key, record.Version); err != nil {
+			return err
+		}
+		// The nonce tells whether this instance's update won.
+		check := &RateLimitRecord{}
+		if err := store.Driver.FirstWhere(check, "id = ? AND version = ?", key, record.Version+1); err == nil && check.Nonce == nonce {
+			return nil
+		}
+	}
+	if lastErr != nil {
+		return lastErr
+	}
+	return ConflictError
+}
+
+// Purge deletes expired records.  Run it periodically to keep the table small.
+func (store *RepositoryStore) Purge() error {
+	table := store.Driver.TableName(&RateLimitRecord{})
+	return store.Driver.Exec(fmt.Sprintf(`DELETE FROM %s WHERE expires_at < ?`, table), time.Now())
+}
+
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
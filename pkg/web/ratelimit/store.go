@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// State is the per-key state of a Limiter.
+type State struct {
+	Level     float64   // tokens remaining (TokenBucket) or requests in the current window (SlidingWindow).
+	PrevLevel float64   // requests in the previous window (SlidingWindow only).
+	Stamp     time.Time // time of the last refill (TokenBucket) or start of the current window (SlidingWindow).
+}
+
+// Store persists limiter state.
+type Store interface {
+	// Update atomically replaces the state stored under key with the result of
+	// fn, which receives the zero State for unknown or expired keys.  The state
+	// may be discarded once ttl has passed without updates.
+	//
+	// NB: fn may be invoked more than once, e.g. by stores which retry on
+	// conflicting concurrent updates.
+	Update(key string, ttl time.Duration, fn func(state State) State) error
+}
+
+// MemoryStoreSweepInterval is how often a MemoryStore discards expired keys.
+var MemoryStoreSweepInterval = time.Minute
+
+// MemoryStore keeps state in process memory, suitable for single-instance
+// deployments.
+type MemoryStore struct {
+	entries   map[string]memoryEntry
+	lastSweep time.Time
+	lock      sync.Mutex
+}
+
+type memoryEntry struct {
+	state   State
+	expires time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	store := &MemoryStore{
+		entries:   map[string]memoryEntry{},
+		lastSweep: time.Now(),
+	}
+	return store
+}
+
+func (store *MemoryStore) Update(key string, ttl time.Duration, fn func(state State) State) error {
+	now := time.Now()
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if now.Sub(store.lastSweep) >= MemoryStoreSweepInterval {
+		for k, entry := range store.entries {
+			if now.After(entry.expires) {
+				delete(store.entries, k)
+			}
+		}
+		store.lastSweep = now
+	}
+
+	entry, ok := store.entries[key]
+	if !ok || now.After(entry.expires) {
+		entry = memoryEntry{}
+	}
+	store.entries[key] = memoryEntry{
+		state:   fn(entry.state),
+		expires: now.Add(ttl),
+	}
+	return nil
+}
+
+// Len returns the number of keys held.
+func (store *MemoryStore) Len() int {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return len(store.entries)
+}
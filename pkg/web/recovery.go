@@ -0,0 +1,84 @@
+package web
+
+import (
+	"net/http"
+	"runtime"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// maxStackBytes bounds the size of captured panic stacks.
+const maxStackBytes = 1048576
+
+// ErrorReporter receives panics recovered by `RecoveryMiddleware', e.g. to
+// forward them to an error tracking service.
+type ErrorReporter interface {
+	ReportPanic(req *http.Request, recovered interface{}, stack []byte)
+}
+
+// ErrorReporterFunc adapts a function to the ErrorReporter interface.
+type ErrorReporterFunc func(req *http.Request, recovered interface{}, stack []byte)
+
+func (fn ErrorReporterFunc) ReportPanic(req *http.Request, recovered interface{}, stack []byte) {
+	fn(req, recovered, stack)
+}
+
+// RecoveryMiddleware recovers from panics in downstream handlers.  The panic is
+// logged along with the full stack and request details, reported to reporter
+// (optional, may be nil), and a JSON 500 error is sent to the client unless the
+// response headers were already written, in which case the response is aborted.
+func RecoveryMiddleware(reporter ErrorReporter) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			cw := NewCapturingResponseWriter(w)
+			defer func() {
+				recovered := recover()
+				if recovered == nil {
+					return
+				}
+				if recovered == http.ErrAbortHandler {
+					// Deliberate abort, leave it to net/http.
+					panic(recovered)
+				}
+				stack := fullStack()
+				RequestLogger(req).WithFields(log.Fields{
+					"method":      req.Method,
+					"uri":         req.RequestURI,
+					"remote_addr": req.RemoteAddr,
+				}).Errorf("web: recovered panic: %v\n%s", recovered, stack)
+				if reporter != nil {
+					reportPanic(reporter, req, recovered, stack)
+				}
+				if cw.WroteHeader() {
+					// Too late to send an error, so make sure the client doesn't
+					// mistake the partial response for a complete one.
+					panic(http.ErrAbortHandler)
+				}
+				RespondWithJson(cw, http.StatusInternalServerError, JsonErrorFor(req, http.StatusText(http.StatusInternalServerError)))
+			}()
+			next.ServeHTTP(cw.Writer(), req)
+		})
+	}
+}
+
+// reportPanic shields the request from a misbehaving reporter.
+func reportPanic(reporter ErrorReporter, req *http.Request, recovered interface{}, stack []byte) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("web: ErrorReporter panicked while reporting panic: %v", r)
+		}
+	}()
+	reporter.ReportPanic(req, recovered, stack)
+}
+
+// fullStack captures the stack trace of the current goroutine, growing the
+// buffer until it fits (in the style of `testlib.Stack()').
+func fullStack() []byte {
+	for size := 8192; ; size *= 2 {
+		buf := make([]byte, size)
+		if n := runtime.Stack(buf, false); n < size || size >= maxStackBytes {
+			return buf[:n]
+		}
+	}
+}
+
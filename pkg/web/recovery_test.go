@@ -0,0 +1,81 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecoveryMiddleware(t *testing.T) {
+	var (
+		reported      interface{}
+		reportedStack string
+	)
+	reporter := ErrorReporterFunc(func(_ *http.Request, recovered interface{}, stack []byte) {
+		reported = recovered
+		reportedStack = string(stack)
+	})
+	handler := RequestIdMiddleware(RecoveryMiddleware(reporter)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		panic("kaboom")
+	})))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIdHeader, "panic-1")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if expected, actual := http.StatusInternalServerError, w.Code; actual != expected {
+		t.Errorf("Expected status-code=%v but actual=%v", expected, actual)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Expected JSON error body but got %q: %s", w.Body.String(), err)
+	}
+	if expected, actual := "panic-1", body["request_id"]; actual != expected {
+		t.Errorf("Expected error body request_id=%v but actual=%v", expected, actual)
+	}
+	if strings.Contains(w.Body.String(), "kaboom") {
+		t.Error("Expected panic value not to be leaked to the client")
+	}
+	if expected, actual := "kaboom", reported; actual != expected {
+		t.Errorf("Expected reported panic=%v but actual=%v", expected, actual)
+	}
+	if !strings.Contains(reportedStack, "TestRecoveryMiddleware") {
+		t.Errorf("Expected reported stack to include the test function but stack=%s", reportedStack)
+	}
+}
+
+func TestRecoveryMiddlewareAfterHeadersWritten(t *testing.T) {
+	server := NewWebServer(WebServerOptions{
+		Addr: testAddr,
+		Handler: RecoveryMiddleware(nil)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Length", "100")
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprint(w, "partial")
+			panic("kaboom")
+		})),
+	})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := server.Stop(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// NB: Depending on buffering the abort surfaces either on the request or
+	// while reading the body.
+	response, err := http.Get(server.BaseUrl())
+	if err == nil {
+		defer response.Body.Close()
+		_, err = ioutil.ReadAll(response.Body)
+	}
+	if err == nil {
+		t.Error("Expected the aborted response to fail")
+	}
+}
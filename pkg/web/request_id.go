@@ -0,0 +1,129 @@
+package web
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// RequestIdHeader carries the ID used to correlate a request with its log
+// lines, error responses and outbound calls.
+const RequestIdHeader = "X-Request-Id"
+
+// MaxRequestIdLength bounds the length of request IDs accepted from clients.
+const MaxRequestIdLength = 128
+
+type requestIdKey struct{}
+
+// RequestIdMiddleware accepts the request ID sent by the client, or generates a
+// new one when absent or malformed, stores it on the request context and
+// echoes it in the response headers.
+func RequestIdMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requestId := req.Header.Get(RequestIdHeader)
+		if !validRequestId(requestId) {
+			requestId = NewRequestId()
+		}
+		w.Header().Set(RequestIdHeader, requestId)
+		next.ServeHTTP(w, req.WithContext(WithRequestId(req.Context(), requestId)))
+	})
+}
+
+// NewRequestId generates a random (version 4) UUID.
+func NewRequestId() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// NB: crypto/rand failing means the system is in a bad way.
+		panic(fmt.Sprintf("web.NewRequestId: reading random bytes: %s", err))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// WithRequestId returns a copy of ctx carrying requestId.
+func WithRequestId(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, requestId)
+}
+
+// RequestIdFromContext returns the request ID carried by ctx, or the empty
+// string.
+func RequestIdFromContext(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdKey{}).(string)
+	return requestId
+}
+
+// RequestId returns the ID assigned to req by `RequestIdMiddleware', or the
+// empty string.
+func RequestId(req *http.Request) string {
+	return RequestIdFromContext(req.Context())
+}
+
+// RequestLogger returns a logrus entry which includes the request ID of req,
+// when it has one.
+func RequestLogger(req *http.Request) *log.Entry {
+	fields := log.Fields{}
+	if requestId := RequestId(req); len(requestId) > 0 {
+		fields["request_id"] = requestId
+	}
+	return log.WithFields(fields)
+}
+
+// ForwardRequestId sets the request ID carried by ctx on an outbound request.
+//
+// Example usage:
+//
+//     outbound, _ := http.NewRequest("GET", "http://other-service/items", nil)
+//     web.ForwardRequestId(req.Context(), outbound)
+//     response, err := http.DefaultClient.Do(outbound)
+func ForwardRequestId(ctx context.Context, outbound *http.Request) {
+	if requestId := RequestIdFromContext(ctx); len(requestId) > 0 {
+		outbound.Header.Set(RequestIdHeader, requestId)
+	}
+}
+
+// RequestIdTransport is an http.RoundTripper which forwards the request ID
+// carried by each outbound request's context, i.e. requests created with
+// `req.WithContext(inbound.Context())'.
+type RequestIdTransport struct {
+	Base http.RoundTripper // http.DefaultTransport if nil.
+}
+
+func (transport *RequestIdTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := transport.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	requestId := RequestIdFromContext(req.Context())
+	if len(requestId) == 0 || req.Header.Get(RequestIdHeader) == requestId {
+		return base.RoundTrip(req)
+	}
+	// NB: RoundTrippers must not modify the request, so send a copy.
+	clone := *req
+	clone.Header = make(http.Header, len(req.Header)+1)
+	for key, values := range req.Header {
+		clone.Header[key] = values
+	}
+	clone.Header.Set(RequestIdHeader, requestId)
+	return base.RoundTrip(&clone)
+}
+
+// validRequestId permits IDs of reasonable length made up of characters which
+// are safe to log.
+func validRequestId(requestId string) bool {
+	if len(requestId) == 0 || len(requestId) > MaxRequestIdLength {
+		return false
+	}
+	for _, r := range requestId {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':', r == '/', r == '+', r == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
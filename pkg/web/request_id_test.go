@@ -0,0 +1,111 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestRequestIdMiddleware(t *testing.T) {
+	var seen string
+	handler := RequestIdMiddleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		seen = RequestId(req)
+	}))
+
+	// Generated when absent or malformed.
+	uuidExpr := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	for _, sent := range []string{"", "bad id\nwith newline"} {
+		req := httptest.NewRequest("GET", "/", nil)
+		if len(sent) > 0 {
+			req.Header.Set(RequestIdHeader, sent)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if !uuidExpr.MatchString(seen) {
+			t.Errorf("Expected a generated UUID request ID for sent=%q but actual=%q", sent, seen)
+		}
+		if expected, actual := seen, w.Header().Get(RequestIdHeader); actual != expected {
+			t.Errorf("Expected response header request ID=%q but actual=%q", expected, actual)
+		}
+	}
+
+	// Accepted from the client.
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIdHeader, "client-id.1")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if expected, actual := "client-id.1", seen; actual != expected {
+		t.Errorf("Expected request ID=%q but actual=%q", expected, actual)
+	}
+	if expected, actual := "client-id.1", w.Header().Get(RequestIdHeader); actual != expected {
+		t.Errorf("Expected response header request ID=%q but actual=%q", expected, actual)
+	}
+}
+
+func TestJsonErrorFor(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	if _, ok := JsonErrorFor(req, errors.New("oops"))["request_id"]; ok {
+		t.Error("Expected no request_id in error body when the request has none")
+	}
+	req = req.WithContext(WithRequestId(req.Context(), "abc"))
+	body := JsonErrorFor(req, errors.New("oops"))
+	if expected, actual := "abc", body["request_id"]; actual != expected {
+		t.Errorf("Expected error body request_id=%v but actual=%v", expected, actual)
+	}
+	if expected, actual := "oops", body["error"]; actual != expected {
+		t.Errorf("Expected error body error=%v but actual=%v", expected, actual)
+	}
+}
+
+func TestRequestIdTransport(t *testing.T) {
+	received := make(chan string, 2)
+	server := NewWebServer(WebServerOptions{
+		Addr: testAddr,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			received <- req.Header.Get(RequestIdHeader)
+		}),
+	})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := server.Stop(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	ctx := WithRequestId(context.Background(), "forwarded-id")
+	client := &http.Client{Transport: &RequestIdTransport{}}
+	outbound, err := http.NewRequest("GET", server.BaseUrl(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := client.Do(outbound.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if expected, actual := "forwarded-id", <-received; actual != expected {
+		t.Errorf("Expected forwarded request ID=%q via transport but actual=%q", expected, actual)
+	}
+	if len(outbound.Header.Get(RequestIdHeader)) > 0 {
+		t.Error("Expected transport not to modify the original request")
+	}
+
+	outbound, err = http.NewRequest("GET", server.BaseUrl(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ForwardRequestId(ctx, outbound)
+	response, err = http.DefaultClient.Do(outbound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if expected, actual := "forwarded-id", <-received; actual != expected {
+		t.Errorf("Expected forwarded request ID=%q via ForwardRequestId but actual=%q", expected, actual)
+	}
+}
@@ -0,0 +1,220 @@
+package web
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// CapturingResponseWriter wraps an http.ResponseWriter and records the status
+// code and number of body bytes written, for use by middleware such as
+// `Metrics.Middleware'.
+type CapturingResponseWriter struct {
+	http.ResponseWriter
+	StatusCode  int   // http.StatusOK when the handler never called `WriteHeader()'.
+	Bytes       int64 // number of body bytes written.
+	wroteHeader bool
+}
+
+func NewCapturingResponseWriter(w http.ResponseWriter) *CapturingResponseWriter {
+	cw := &CapturingResponseWriter{
+		ResponseWriter: w,
+		StatusCode:     http.StatusOK,
+	}
+	return cw
+}
+
+// WroteHeader reports whether the response headers have been sent.
+func (cw *CapturingResponseWriter) WroteHeader() bool {
+	return cw.wroteHeader
+}
+
+func (cw *CapturingResponseWriter) WriteHeader(statusCode int) {
+	if !cw.wroteHeader {
+		cw.StatusCode = statusCode
+		cw.wroteHeader = true
+	}
+	cw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (cw *CapturingResponseWriter) Write(b []byte) (int, error) {
+	cw.wroteHeader = true
+	n, err := cw.ResponseWriter.Write(b)
+	cw.Bytes += int64(n)
+	return n, err
+}
+
+// Writer returns the http.ResponseWriter to hand to the next handler.  It only
+// implements those of http.Flusher, http.Hijacker, http.CloseNotifier and
+// http.Pusher which the underlying writer implements.
+func (cw *CapturingResponseWriter) Writer() http.ResponseWriter {
+	return exposeOptionalInterfaces(cw, cw.ResponseWriter, responseWriterHooks{
+		flush: func() {
+			cw.wroteHeader = true
+			cw.ResponseWriter.(http.Flusher).Flush()
+		},
+		hijack: func() (net.Conn, *bufio.ReadWriter, error) {
+			cw.wroteHeader = true
+			return cw.ResponseWriter.(http.Hijacker).Hijack()
+		},
+	})
+}
+
+// responseWriterHooks override the behaviour of optional interfaces exposed by
+// exposeOptionalInterfaces.  Nil hooks delegate to the underlying writer.
+type responseWriterHooks struct {
+	flush  func()
+	hijack func() (net.Conn, *bufio.ReadWriter, error)
+}
+
+type (
+	flusherFunc  func()
+	hijackerFunc func() (net.Conn, *bufio.ReadWriter, error)
+)
+
+func (fn flusherFunc) Flush() {
+	fn()
+}
+
+func (fn hijackerFunc) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return fn()
+}
+
+// exposeOptionalInterfaces combines wrapper with exactly the optional
+// interfaces implemented by underlying, so type assertions made by handlers
+// only succeed when the functionality is really available.
+func exposeOptionalInterfaces(wrapper http.ResponseWriter, underlying http.ResponseWriter, hooks responseWriterHooks) http.ResponseWriter {
+	var (
+		f  http.Flusher
+		h  http.Hijacker
+		cn http.CloseNotifier
+		p  http.Pusher
+	)
+	if flusher, ok := underlying.(http.Flusher); ok {
+		f = flusher
+		if hooks.flush != nil {
+			f = flusherFunc(hooks.flush)
+		}
+	}
+	if hijacker, ok := underlying.(http.Hijacker); ok {
+		h = hijacker
+		if hooks.hijack != nil {
+			h = hijackerFunc(hooks.hijack)
+		}
+	}
+	if notifier, ok := underlying.(http.CloseNotifier); ok {
+		cn = notifier
+	}
+	if pusher, ok := underlying.(http.Pusher); ok {
+		p = pusher
+	}
+
+	var index int
+	if f != nil {
+		index |= 1
+	}
+	if h != nil {
+		index |= 2
+	}
+	if cn != nil {
+		index |= 4
+	}
+	if p != nil {
+		index |= 8
+	}
+	switch index {
+	case 1:
+		return struct {
+			http.ResponseWriter
+			http.Flusher
+		}{wrapper, f}
+	case 2:
+		return struct {
+			http.ResponseWriter
+			http.Hijacker
+		}{wrapper, h}
+	case 3:
+		return struct {
+			http.ResponseWriter
+			http.Flusher
+			http.Hijacker
+		}{wrapper, f, h}
+	case 4:
+		return struct {
+			http.ResponseWriter
+			http.CloseNotifier
+		}{wrapper, cn}
+	case 5:
+		return struct {
+			http.ResponseWriter
+			http.Flusher
+			http.CloseNotifier
+		}{wrapper, f, cn}
+	case 6:
+		return struct {
+			http.ResponseWriter
+			http.Hijacker
+			http.CloseNotifier
+		}{wrapper, h, cn}
+	case 7:
+		return struct {
+			http.ResponseWriter
+			http.Flusher
+			http.Hijacker
+			http.CloseNotifier
+		}{wrapper, f, h, cn}
+	case 8:
+		return struct {
+			http.ResponseWriter
+			http.Pusher
+		}{wrapper, p}
+	case 9:
+		return struct {
+			http.ResponseWriter
+			http.Flusher
+			http.Pusher
+		}{wrapper, f, p}
+	case 10:
+		return struct {
+			http.ResponseWriter
+			http.Hijacker
+			http.Pusher
+		}{wrapper, h, p}
+	case 11:
+		return struct {
+			http.ResponseWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{wrapper, f, h, p}
+	case 12:
+		return struct {
+			http.ResponseWriter
+			http.CloseNotifier
+			http.Pusher
+		}{wrapper, cn, p}
+	case 13:
+		return struct {
+			http.ResponseWriter
+			http.Flusher
+			http.CloseNotifier
+			http.Pusher
+		}{wrapper, f, cn, p}
+	case 14:
+		return struct {
+			http.ResponseWriter
+			http.Hijacker
+			http.CloseNotifier
+			http.Pusher
+		}{wrapper, h, cn, p}
+	case 15:
+		return struct {
+			http.ResponseWriter
+			http.Flusher
+			http.Hijacker
+			http.CloseNotifier
+			http.Pusher
+		}{wrapper, f, h, cn, p}
+	}
+	return wrapper
+}
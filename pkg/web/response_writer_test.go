@@ -0,0 +1,56 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// plainResponseWriter implements none of the optional interfaces.
+type plainResponseWriter struct {
+	http.ResponseWriter
+}
+
+func TestResponseWriterOptionalInterfaces(t *testing.T) {
+	assertInterfaces := func(name string, w http.ResponseWriter, expectFlusher bool) {
+		if _, ok := w.(http.Flusher); ok != expectFlusher {
+			t.Errorf("[%v] Expected http.Flusher=%v but actual=%v", name, expectFlusher, ok)
+		}
+		if _, ok := w.(http.Hijacker); ok {
+			t.Errorf("[%v] Expected writer to not implement http.Hijacker", name)
+		}
+		if _, ok := w.(http.CloseNotifier); ok {
+			t.Errorf("[%v] Expected writer to not implement http.CloseNotifier", name)
+		}
+		if _, ok := w.(http.Pusher); ok {
+			t.Errorf("[%v] Expected writer to not implement http.Pusher", name)
+		}
+	}
+
+	for _, expectFlusher := range []bool{true, false} {
+		var underlying http.ResponseWriter = httptest.NewRecorder()
+		if !expectFlusher {
+			underlying = plainResponseWriter{underlying}
+		}
+
+		assertInterfaces("capturing", NewCapturingResponseWriter(underlying).Writer(), expectFlusher)
+
+		compression, err := CompressionMiddleware(CompressionOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler := compression(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			assertInterfaces("compressing", w, expectFlusher)
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		handler.ServeHTTP(underlying, req)
+	}
+
+	// Flushing through the capturing writer marks the headers as sent.
+	cw := NewCapturingResponseWriter(httptest.NewRecorder())
+	cw.Writer().(http.Flusher).Flush()
+	if !cw.WroteHeader() {
+		t.Error("Expected WroteHeader()=true after Flush()")
+	}
+}
@@ -0,0 +1,158 @@
+package route
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/gigawattio/go-commons/pkg/web"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// RouteInfo describes a route registered by `Activate'.
+type RouteInfo struct {
+	Bundle      int       `json:"bundle"` // index of the RouteMiddlewareBundle the route belongs to.
+	Method      string    `json:"method"`
+	Path        string    `json:"path"`
+	Name        string    `json:"name,omitempty"`
+	Handler     string    `json:"handler"`
+	Middlewares []string  `json:"middlewares"`         // outermost first, including those of earlier bundles.
+	Automatic   bool      `json:"automatic,omitempty"` // true for HEAD routes derived from GET and CORS preflight routes.
+	Mount       bool      `json:"mount,omitempty"`     // true for routes serving a `Mount'.
+	Doc         *RouteDoc `json:"-"`
+}
+
+// Routes returns every route `Activate' registers for rmbs, in the order the
+// bundles are tried.  The same errors as `Activate' are returned.
+func Routes(rmbs []RouteMiddlewareBundle) ([]RouteInfo, error) {
+	_, routes, err := activate(rmbs)
+	return routes, err
+}
+
+var debugTemplate = template.Must(template.New("routes").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Routes</title></head>
+<body>
+<table>
+<tr><th>Bundle</th><th>Method</th><th>Path</th><th>Name</th><th>Handler</th><th>Middlewares</th></tr>
+{{range .}}<tr><td>{{.Bundle}}</td><td>{{.Method}}{{if .Automatic}} (auto){{end}}</td><td>{{.Path}}</td><td>{{.Name}}</td><td>{{.Handler}}</td><td>{{range $i, $m := .Middlewares}}{{if $i}} &rarr; {{end}}{{$m}}{{end}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// DebugHandler renders routes (see `Routes()') as JSON, or as an HTML table
+// when requested with "?format=html" or an Accept header preferring text/html.
+// It should only be exposed to trusted clients.
+func DebugHandler(routes []RouteInfo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		format := req.URL.Query().Get("format")
+		if format == "html" || (len(format) == 0 && strings.HasPrefix(req.Header.Get("Accept"), "text/html")) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			if err := debugTemplate.Execute(w, routes); err != nil {
+				web.RequestLogger(req).Errorf("route: rendering debug page: %s", err)
+			}
+			return
+		}
+		web.RespondWithJson(w, http.StatusOK, routes)
+	})
+}
+
+// checkShadowing returns an error when a route can never match because a
+// route of an earlier bundle matches every request it would, and logs a
+// warning for routes which are only partially shadowed.  Routes within a
+// bundle are checked by httprouter.
+func checkShadowing(routes []RouteInfo) error {
+	for j, later := range routes {
+		for _, earlier := range routes[:j] {
+			if earlier.Bundle == later.Bundle || earlier.Method != later.Method {
+				continue
+			}
+			if patternCovers(earlier.Path, later.Path) {
+				if earlier.Automatic || later.Automatic {
+					log.Warnf("route: method=%s path=%v of bundle %v is shadowed by path=%v of bundle %v", later.Method, later.Path, later.Bundle, earlier.Path, earlier.Bundle)
+					continue
+				}
+				return fmt.Errorf("route: method=%s path=%v of bundle %v is shadowed by path=%v of bundle %v", later.Method, later.Path, later.Bundle, earlier.Path, earlier.Bundle)
+			}
+			if patternsOverlap(earlier.Path, later.Path) {
+				log.Warnf("route: method=%s path=%v of bundle %v conflicts with path=%v of bundle %v, which takes precedence", later.Method, later.Path, later.Bundle, earlier.Path, earlier.Bundle)
+			}
+		}
+	}
+	return nil
+}
+
+// patternCovers reports whether every path matching pattern b also matches
+// pattern a.
+func patternCovers(a string, b string) bool {
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+	for i, segment := range as {
+		if strings.HasPrefix(segment, "*") {
+			return len(bs) > i
+		}
+		if i >= len(bs) || strings.HasPrefix(bs[i], "*") {
+			return false
+		}
+		if strings.HasPrefix(segment, ":") {
+			if len(bs[i]) == 0 {
+				return false
+			}
+			continue
+		}
+		if segment != bs[i] {
+			return false
+		}
+	}
+	return len(as) == len(bs)
+}
+
+// patternsOverlap reports whether some path matches both patterns.
+func patternsOverlap(a string, b string) bool {
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if strings.HasPrefix(as[i], "*") || strings.HasPrefix(bs[i], "*") {
+			return true
+		}
+		if strings.HasPrefix(as[i], ":") || strings.HasPrefix(bs[i], ":") || as[i] == bs[i] {
+			continue
+		}
+		return false
+	}
+	return len(as) == len(bs)
+}
+
+// funcName returns the qualified name of the function fn.
+func funcName(fn interface{}) string {
+	value := reflect.ValueOf(fn)
+	if value.Kind() != reflect.Func || value.IsNil() {
+		return fmt.Sprintf("%T", fn)
+	}
+	if f := runtime.FuncForPC(value.Pointer()); f != nil {
+		return f.Name()
+	}
+	return fmt.Sprintf("%T", fn)
+}
+
+func funcNames(middlewares ...[]func(http.Handler) http.Handler) []string {
+	names := []string{}
+	for _, m := range middlewares {
+		for _, middleware := range m {
+			names = append(names, funcName(middleware))
+		}
+	}
+	return names
+}
+
+// handlerName names handler by its function for http.HandlerFunc's and its type
+// otherwise.
+func handlerName(handler http.Handler) string {
+	if handlerFunc, ok := handler.(http.HandlerFunc); ok {
+		return funcName((func(http.ResponseWriter, *http.Request))(handlerFunc))
+	}
+	return fmt.Sprintf("%T", handler)
+}
@@ -0,0 +1,107 @@
+package route_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gigawattio/go-commons/pkg/web/route"
+)
+
+func passThrough(next http.Handler) http.Handler { return next }
+
+func listItems(w http.ResponseWriter, req *http.Request) {}
+
+func TestRoutes(t *testing.T) {
+	routes, err := route.Routes(
+		[]route.RouteMiddlewareBundle{
+			route.RouteMiddlewareBundle{
+				Middlewares: []func(http.Handler) http.Handler{passThrough},
+				RouteData: []route.RouteDatum{
+					{Name: "items", Reciever: "get", Path: "/items", HandlerFunc: listItems},
+				},
+			},
+			route.RouteMiddlewareBundle{
+				RouteData: []route.RouteDatum{
+					{Reciever: "post", Path: "/items", HandlerFunc: listItems, Middlewares: []func(http.Handler) http.Handler{passThrough}},
+				},
+			},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const (
+		handler    = "github.com/gigawattio/go-commons/pkg/web/route_test.listItems"
+		middleware = "github.com/gigawattio/go-commons/pkg/web/route_test.passThrough"
+	)
+	expected := []route.RouteInfo{
+		{Bundle: 0, Method: "GET", Path: "/items", Name: "items", Handler: handler, Middlewares: []string{middleware}},
+		{Bundle: 0, Method: "HEAD", Path: "/items", Name: "items", Handler: handler, Middlewares: []string{middleware}, Automatic: true},
+		{Bundle: 1, Method: "POST", Path: "/items", Handler: handler, Middlewares: []string{middleware, middleware}},
+	}
+	if expected, actual := fmt.Sprintf("%+v", expected), fmt.Sprintf("%+v", routes); actual != expected {
+		t.Errorf("Expected routes=%v but actual=%v", expected, actual)
+	}
+}
+
+func TestShadowedRoutes(t *testing.T) {
+	ok := func(w http.ResponseWriter, req *http.Request) {}
+	testCases := []struct {
+		earlier  string
+		later    string
+		shadowed bool
+	}{
+		{"/items", "/items", true},
+		{"/users/:id", "/users/:uid", true},
+		{"/users/:id", "/users/new", true},
+		{"/files/*filepath", "/files/css/:name", true},
+		{"/users/new", "/users/:id", false},
+		{"/users/:id", "/users/:id/posts", false},
+		{"/users/:id", "/users", false},
+	}
+	for i, testCase := range testCases {
+		_, err := route.Activate(
+			[]route.RouteMiddlewareBundle{
+				{RouteData: []route.RouteDatum{{Reciever: "get", Path: testCase.earlier, HandlerFunc: ok}}},
+				{RouteData: []route.RouteDatum{{Reciever: "get", Path: testCase.later, HandlerFunc: ok}}},
+			},
+		)
+		if expected, actual := testCase.shadowed, err != nil; actual != expected {
+			t.Errorf("[i=%v] Expected shadowed=%v for earlier=%v later=%v but actual=%v (err=%v)", i, expected, testCase.earlier, testCase.later, actual, err)
+		}
+	}
+}
+
+func TestDebugHandler(t *testing.T) {
+	routes := []route.RouteInfo{
+		{Method: "GET", Path: "/items/:id", Handler: "main.getItem", Middlewares: []string{"main.auth"}},
+	}
+	handler := route.DebugHandler(routes)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/routes", nil))
+	var decoded []route.RouteInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &decoded); err != nil {
+		t.Fatalf("Unexpected error decoding JSON body=%q: %s", rec.Body.String(), err)
+	}
+	if expected, actual := fmt.Sprintf("%+v", routes), fmt.Sprintf("%+v", decoded); actual != expected {
+		t.Errorf("Expected decoded routes=%v but actual=%v", expected, actual)
+	}
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/debug/routes", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	handler.ServeHTTP(rec, req)
+	if expected, actual := "text/html; charset=utf-8", rec.Header().Get("Content-Type"); actual != expected {
+		t.Errorf("Expected Content-Type=%q but actual=%q", expected, actual)
+	}
+	for _, expected := range []string{"/items/:id", "main.getItem", "main.auth"} {
+		if !strings.Contains(rec.Body.String(), expected) {
+			t.Errorf("Expected HTML body to contain %q but body=%q", expected, rec.Body.String())
+		}
+	}
+}
@@ -1,69 +1,419 @@
 package route
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 
+	"github.com/gigawattio/go-commons/pkg/web"
+
 	log "github.com/Sirupsen/logrus"
 	"github.com/nbio/hitch"
 )
 
 // RouteMiddlewareBundle is the struct which represents a group of
 // middleware + route entries.
+//
+// Bundles may be nested via `Groups' to mount routes under a common path
+// prefix with additional middleware, e.g.:
+//
+//     route.RouteMiddlewareBundle{
+//         Prefix: "/v1",
+//         RouteData: []route.RouteDatum{...},
+//         Groups: []route.RouteMiddlewareBundle{
+//             {
+//                 Prefix:      "/admin",
+//                 Middlewares: []func(http.Handler) http.Handler{adminAuth},
+//                 RouteData:   []route.RouteDatum{...}, // Served under /v1/admin.
+//             },
+//         },
+//         Mounts: []route.Mount{
+//             {Prefix: "/static", Handler: fsServer.Handler()},
+//         },
+//     }
 type RouteMiddlewareBundle struct {
+	Prefix      string // Optional path prefix for the bundle's routes, mounts and groups.
 	Middlewares []func(http.Handler) http.Handler
 	RouteData   []RouteDatum
+	Mounts      []Mount
+	Groups      []RouteMiddlewareBundle // Nested bundles, their middlewares only apply to their own routes and they inherit the parent's prefix, middlewares and CORS policy.
+	Cors        *web.CorsOptions        // Optional CORS policy for the bundle's routes, preflight OPTIONS requests are answered automatically, see `web.SkipPreflight()' for authentication middlewares.
+}
+
+// Mount serves every request under a path prefix with an arbitrary
+// http.Handler, which sees the request path with the prefix stripped.
+type Mount struct {
+	Prefix      string // Must not be empty or "/".
+	Handler     http.Handler
+	Middlewares []func(http.Handler) http.Handler // Optional middleware for the mount only.
 }
 
+// AnyMethods are the methods a route with the "*" or "any" Reciever is
+// registered for.
+var AnyMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+
 // RouteDatum encompasses a single route entry.
 type RouteDatum struct {
-	Reciever    string // One of: "get", "post", "put", "patch", or "delete".  Or a combination of them separated by pipes, e.g.: "post|put"
+	Name        string // Optional name, unique across all bundles, for producing the route's URL with a `UrlBuilder'.
+	Reciever    string // One of: "get", "head", "post", "put", "patch", "delete", "options", or "*" / "any" for all of them.  Or a combination separated by pipes, e.g.: "post|put".  GET routes also answer HEAD unless one is registered for the path.
 	Path        string
 	HandlerFunc func(w http.ResponseWriter, req *http.Request)
+	Middlewares []func(http.Handler) http.Handler // Optional middleware for this route only.
+	Doc         *RouteDoc                         // Optional API documentation, see the `openapi' package.
+}
+
+// RouteDoc describes a route for API documentation.
+type RouteDoc struct {
+	Summary     string
+	Description string
+	Tags        []string
+	Request     interface{} // value of the request body type, e.g. User{}.
+	Response    interface{} // value of the response body type, e.g. User{} or generics.ApiResponse{Objects: []User{}}.
+	PathParams  []ParamDoc  // descriptions of the path's parameters, which are otherwise documented as required strings.
+	QueryParams []ParamDoc
+	Statuses    []int // possible response status codes, 201 for POST and 200 otherwise if empty.
 }
 
-type HttpMethodReceiver func(path string, handler http.Handler, middleware ...func(http.Handler) http.Handler)
+// ParamDoc describes a path or query parameter.
+type ParamDoc struct {
+	Name        string
+	Description string
+	Type        string // JSON schema type, "string" if empty.
+	Required    bool   // path parameters are always required.
+}
 
-// Activate prepares a hitch for a single RouteMiddlewareBundle.
-func (rmb *RouteMiddlewareBundle) Activate() *hitch.Hitch {
-	h := hitch.New()
-	h.Use(rmb.Middlewares...)
+// Methods resolves the Reciever into upper-case HTTP method names.
+func (routeDatum RouteDatum) Methods() ([]string, error) {
+	var (
+		methods = []string{}
+		seen    = map[string]bool{}
+	)
+	for _, method := range strings.Split(routeDatum.Reciever, "|") {
+		method = strings.ToUpper(strings.TrimSpace(method))
+		expanded := []string{method}
+		if method == "*" || method == "ANY" {
+			expanded = AnyMethods
+		} else if !isKnownMethod(method) {
+			return nil, fmt.Errorf("route: unsupported method %q for path=%v", method, routeDatum.Path)
+		}
+		for _, m := range expanded {
+			if !seen[m] {
+				seen[m] = true
+				methods = append(methods, m)
+			}
+		}
+	}
+	return methods, nil
+}
+
+func isKnownMethod(method string) bool {
+	for _, known := range AnyMethods {
+		if method == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Activate prepares a hitch for a single RouteMiddlewareBundle (see the
+// package-level `Activate()').
+func (rmb *RouteMiddlewareBundle) Activate() (*hitch.Hitch, error) {
+	return Activate([]RouteMiddlewareBundle{*rmb})
+}
+
+// routeEntry is a route with its full path and the middleware of any enclosing
+// groups applied.
+type routeEntry struct {
+	methods         []string
+	path            string
+	name            string
+	doc             *RouteDoc
+	mount           bool
+	handler         http.Handler
+	handlerName     string
+	middlewareNames []string
+	cors            *web.CorsOptions
+}
+
+// entries flattens the bundle and its groups into routeEntry's.
+func (rmb *RouteMiddlewareBundle) entries(prefix string, middlewares []func(http.Handler) http.Handler, cors *web.CorsOptions) ([]routeEntry, error) {
+	prefix = joinPath(prefix, rmb.Prefix)
+	if rmb.Cors != nil {
+		cors = rmb.Cors
+	}
+	entries := []routeEntry{}
 	for _, routeDatum := range rmb.RouteData {
-		for _, method := range strings.Split(routeDatum.Reciever, "|") {
-			receiverFunc := rmb.lookupReceiver(h, method)
-			receiverFunc(routeDatum.Path, http.HandlerFunc(routeDatum.HandlerFunc))
-			log.Debugf("route: registered method=%s path=%s", method, routeDatum.Path)
+		methods, err := routeDatum.Methods()
+		if err != nil {
+			return nil, err
+		}
+		entry := routeEntry{
+			methods:         methods,
+			path:            joinPath(prefix, routeDatum.Path),
+			name:            routeDatum.Name,
+			doc:             routeDatum.Doc,
+			handler:         chain(http.HandlerFunc(routeDatum.HandlerFunc), middlewares, routeDatum.Middlewares),
+			handlerName:     funcName(routeDatum.HandlerFunc),
+			middlewareNames: funcNames(middlewares, routeDatum.Middlewares),
+			cors:            cors,
+		}
+		entries = append(entries, entry)
+	}
+	for _, mount := range rmb.Mounts {
+		mountPrefix := strings.TrimSuffix(joinPath(prefix, mount.Prefix), "/")
+		if len(mountPrefix) == 0 {
+			return nil, errors.New("route: a Mount requires a non-root prefix")
 		}
+		if mount.Handler == nil {
+			return nil, fmt.Errorf("route: nil Handler for Mount with prefix=%v", mountPrefix)
+		}
+		entry := routeEntry{
+			methods:         AnyMethods,
+			path:            mountPrefix + "/*path",
+			mount:           true,
+			handler:         chain(http.StripPrefix(mountPrefix, mount.Handler), middlewares, mount.Middlewares),
+			handlerName:     handlerName(mount.Handler),
+			middlewareNames: funcNames(middlewares, mount.Middlewares),
+			cors:            cors,
+		}
+		entries = append(entries, entry)
 	}
-	return h
+	for _, group := range rmb.Groups {
+		groupMiddlewares := append(middlewares[:len(middlewares):len(middlewares)], group.Middlewares...)
+		groupEntries, err := group.entries(prefix, groupMiddlewares, cors)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, groupEntries...)
+	}
+	return entries, nil
 }
 
-// lookupReceiver takes an HTTP method string and returns the corresponding
-// hitch.{method} function.
-func (rmb *RouteMiddlewareBundle) lookupReceiver(h *hitch.Hitch, method string) HttpMethodReceiver {
-	switch strings.ToLower(method) {
-	case "get":
-		return h.Get
-	case "post":
-		return h.Post
-	case "put":
-		return h.Put
-	case "patch":
-		return h.Patch
-	case "delete":
-		return h.Delete
-	default:
-		panic(fmt.Sprintf("unable to resolve route for http method: %s", method))
+// activate registers the bundle's routes with a new hitch, returning them as
+// RouteInfo's.
+func (rmb *RouteMiddlewareBundle) activate() (h *hitch.Hitch, routes []RouteInfo, err error) {
+	h = hitch.New()
+	// NB: OPTIONS is answered by fallbackHandler, which knows about the routes
+	// of every bundle.
+	h.Router.HandleOPTIONS = false
+	h.Use(rmb.Middlewares...)
+
+	// NB: The bundle's own middlewares wrap the whole hitch, so only those of
+	// nested groups are applied per route.
+	entries, err := rmb.entries("", nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		pathMethods = map[string][]string{}
+		pathCors    = map[string]*web.CorsOptions{}
+	)
+	for _, entry := range entries {
+		pathMethods[entry.path] = append(pathMethods[entry.path], entry.methods...)
+		if _, ok := pathCors[entry.path]; !ok && entry.cors != nil {
+			pathCors[entry.path] = entry.cors
+		}
+	}
+	// GET routes answer HEAD too unless the path has its own HEAD route.
+	autoHead := map[string]bool{}
+	for path, methods := range pathMethods {
+		if containsMethod(methods, "GET") && !containsMethod(methods, "HEAD") {
+			autoHead[path] = true
+			pathMethods[path] = append(pathMethods[path], "HEAD")
+		}
 	}
+	corsPolicies := newCorsPolicies(pathMethods, pathCors)
+
+	defer func() {
+		// NB: httprouter panics on duplicate and conflicting routes.
+		if r := recover(); r != nil {
+			h, routes, err = nil, nil, fmt.Errorf("route: %v", r)
+		}
+	}()
+	bundleMiddlewareNames := funcNames(rmb.Middlewares)
+	for _, entry := range entries {
+		var (
+			handler         = entry.handler
+			middlewareNames = append(bundleMiddlewareNames[:len(bundleMiddlewareNames):len(bundleMiddlewareNames)], entry.middlewareNames...)
+		)
+		if cors, ok := corsPolicies[entry.path]; ok {
+			handler = cors.Middleware(handler)
+			middlewareNames = append(middlewareNames, funcName(cors.Middleware))
+		}
+		handler = web.WithRoutePattern(entry.path, handler)
+		methods := entry.methods
+		if autoHead[entry.path] && containsMethod(methods, "GET") {
+			methods = append(methods[:len(methods):len(methods)], "HEAD")
+		}
+		for _, method := range methods {
+			h.Handle(method, entry.path, handler)
+			log.Debugf("route: registered method=%s path=%s", method, entry.path)
+			info := RouteInfo{
+				Method:      method,
+				Path:        entry.path,
+				Name:        entry.name,
+				Handler:     entry.handlerName,
+				Middlewares: middlewareNames,
+				Automatic:   method == "HEAD" && !containsMethod(entry.methods, "HEAD"),
+				Mount:       entry.mount,
+				Doc:         entry.doc,
+			}
+			routes = append(routes, info)
+		}
+	}
+	for path, cors := range corsPolicies {
+		allow := allowHeader(append(pathMethods[path], "OPTIONS"))
+		options := func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Allow", allow)
+			w.WriteHeader(http.StatusNoContent)
+		}
+		if containsMethod(pathMethods[path], "OPTIONS") {
+			// The path's own OPTIONS route is already wrapped with the policy.
+			continue
+		}
+		h.Handle("OPTIONS", path, web.WithRoutePattern(path, cors.Middleware(http.HandlerFunc(options))))
+		log.Debugf("route: registered CORS preflight method=OPTIONS path=%s", path)
+		info := RouteInfo{
+			Method:      "OPTIONS",
+			Path:        path,
+			Handler:     "CORS preflight",
+			Middlewares: append(bundleMiddlewareNames[:len(bundleMiddlewareNames):len(bundleMiddlewareNames)], funcName(cors.Middleware)),
+			Automatic:   true,
+		}
+		routes = append(routes, info)
+	}
+	return h, routes, nil
+}
+
+// newCorsPolicies produces a CORS policy for each path which has one.  When the
+// policy doesn't specify the allowed methods, the path's methods (including
+// OPTIONS) are allowed.
+func newCorsPolicies(pathMethods map[string][]string, pathCors map[string]*web.CorsOptions) map[string]*web.Cors {
+	policies := map[string]*web.Cors{}
+	for path, corsOptions := range pathCors {
+		options := *corsOptions
+		if len(options.AllowedMethods) == 0 {
+			methods := pathMethods[path]
+			options.AllowedMethods = orderMethods(append(methods[:len(methods):len(methods)], "OPTIONS"))
+		}
+		policies[path] = web.NewCors(options)
+	}
+	return policies
+}
+
+// chain wraps handler with the middlewares, the first being outermost.
+func chain(handler http.Handler, middlewares ...[]func(http.Handler) http.Handler) http.Handler {
+	all := []func(http.Handler) http.Handler{}
+	for _, m := range middlewares {
+		all = append(all, m...)
+	}
+	for i := len(all) - 1; i >= 0; i-- {
+		handler = all[i](handler)
+	}
+	return handler
+}
+
+// joinPath appends path to prefix, avoiding a doubled slash.
+func joinPath(prefix string, path string) string {
+	if len(prefix) == 0 {
+		return path
+	}
+	if len(path) == 0 {
+		return prefix
+	}
+	return strings.TrimSuffix(prefix, "/") + "/" + strings.TrimPrefix(path, "/")
+}
+
+// fallbackHandler answers requests which none of the hitches' routes matched.
+func fallbackHandler(hitches []*hitch.Hitch) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		allowed := []string{}
+		for _, method := range AnyMethods {
+			for _, h := range hitches {
+				if handle, _, _ := h.Router.Lookup(method, req.URL.Path); handle != nil {
+					allowed = append(allowed, method)
+					break
+				}
+			}
+		}
+		if len(allowed) == 0 {
+			http.NotFound(w, req)
+			return
+		}
+		if !containsMethod(allowed, "OPTIONS") {
+			allowed = append(allowed, "OPTIONS")
+		}
+		w.Header().Set("Allow", allowHeader(allowed))
+		if req.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	})
+}
+
+// allowHeader produces an Allow header value listing methods.
+func allowHeader(methods []string) string {
+	return strings.Join(orderMethods(methods), ", ")
+}
+
+// orderMethods de-duplicates methods and sorts them in the order of AnyMethods.
+func orderMethods(methods []string) []string {
+	ordered := []string{}
+	for _, method := range AnyMethods {
+		if containsMethod(methods, method) {
+			ordered = append(ordered, method)
+		}
+	}
+	return ordered
+}
+
+func containsMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
 }
 
 // Activate hitches one or more RouteMiddlewareBundle structs together.
-func Activate(rmbs []RouteMiddlewareBundle) *hitch.Hitch {
-	var head *hitch.Hitch
-	var tail *hitch.Hitch // Used to auto-link hitches together.
-	for _, rmb := range rmbs {
-		h := rmb.Activate()
+// Requests for which no route matches are answered with 405 Method Not Allowed
+// when the path has routes for other methods, OPTIONS requests with the path's
+// methods in the Allow header, and otherwise 404 Not Found.
+//
+// An error is returned when a route has an unsupported method, conflicts with
+// another route in its bundle, or is shadowed by a route of an earlier bundle
+// so that it can never match.
+func Activate(rmbs []RouteMiddlewareBundle) (*hitch.Hitch, error) {
+	h, _, err := activate(rmbs)
+	return h, err
+}
+
+func activate(rmbs []RouteMiddlewareBundle) (*hitch.Hitch, []RouteInfo, error) {
+	if len(rmbs) == 0 {
+		return nil, nil, errors.New("route: no RouteMiddlewareBundles to activate")
+	}
+	var (
+		head       *hitch.Hitch
+		tail       *hitch.Hitch // Used to auto-link hitches together.
+		hitches    = make([]*hitch.Hitch, 0, len(rmbs))
+		routes     = []RouteInfo{}
+		// NB: Each bundle's middlewares also wrap the bundles after it.
+		outerMiddlewareNames = []string{}
+	)
+	for i, rmb := range rmbs {
+		h, bundleRoutes, err := rmb.activate()
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, info := range bundleRoutes {
+			info.Bundle = i
+			info.Middlewares = append(outerMiddlewareNames[:len(outerMiddlewareNames):len(outerMiddlewareNames)], info.Middlewares...)
+			routes = append(routes, info)
+		}
+		outerMiddlewareNames = append(outerMiddlewareNames, funcNames(rmb.Middlewares)...)
 		if head == nil {
 			head = h
 		}
@@ -71,6 +421,11 @@ func Activate(rmbs []RouteMiddlewareBundle) *hitch.Hitch {
 			tail.Next(h.Handler())
 		}
 		tail = h
+		hitches = append(hitches, h)
+	}
+	if err := checkShadowing(routes); err != nil {
+		return nil, nil, err
 	}
-	return head
+	tail.Next(fallbackHandler(hitches))
+	return head, routes, nil
 }
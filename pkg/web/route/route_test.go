@@ -2,7 +2,9 @@ package route_test
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"sync/atomic"
 	"testing"
 
@@ -16,29 +18,32 @@ type MyWebService struct {
 	NumLoggerInvocations int64
 }
 
-func NewMyWebService() *MyWebService {
+func NewMyWebService() (*MyWebService, error) {
 	mws := &MyWebService{}
+	h, err := mws.activateRoutes()
+	if err != nil {
+		return nil, err
+	}
 	mws.WebServer = web.NewWebServer(web.WebServerOptions{
 		Addr:    "127.0.0.1:0",
-		Handler: mws.activateRoutes().Handler(),
+		Handler: h.Handler(),
 	})
-	return mws
+	return mws, nil
 }
 
-func (service *MyWebService) activateRoutes() *hitch.Hitch {
-	h := route.Activate(
+func (service *MyWebService) activateRoutes() (*hitch.Hitch, error) {
+	return route.Activate(
 		[]route.RouteMiddlewareBundle{
 			route.RouteMiddlewareBundle{
 				Middlewares: []func(http.Handler) http.Handler{
 					service.loggerMiddleware,
 				},
 				RouteData: []route.RouteDatum{
-					{"get", "/", func(w http.ResponseWriter, req *http.Request) { fmt.Fprint(w, "hello world") }},
+					{Reciever: "get", Path: "/", HandlerFunc: func(w http.ResponseWriter, req *http.Request) { fmt.Fprint(w, "hello world") }},
 				},
 			},
 		},
 	)
-	return h
 }
 
 func (service *MyWebService) loggerMiddleware(next http.Handler) http.Handler {
@@ -49,7 +54,10 @@ func (service *MyWebService) loggerMiddleware(next http.Handler) http.Handler {
 }
 
 func TestMiddlewares(t *testing.T) {
-	mws := NewMyWebService()
+	mws, err := NewMyWebService()
+	if err != nil {
+		t.Fatal(err)
+	}
 	if err := mws.Start(); err != nil {
 		t.Fatal(err)
 	}
@@ -71,3 +79,363 @@ func TestMiddlewares(t *testing.T) {
 		}
 	}
 }
+
+func TestRoutePattern(t *testing.T) {
+	var pattern string
+	h, err := route.Activate(
+		[]route.RouteMiddlewareBundle{
+			route.RouteMiddlewareBundle{
+				RouteData: []route.RouteDatum{
+					{Reciever: "get", Path: "/users/:id", HandlerFunc: func(w http.ResponseWriter, req *http.Request) { fmt.Fprint(w, "user") }},
+				},
+			},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Simulate a middleware wrapping the router.
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req = web.TrackRoutePattern(req)
+		h.Handler().ServeHTTP(w, req)
+		pattern = web.RoutePattern(req)
+	})
+	ws := web.NewWebServer(web.WebServerOptions{Addr: "127.0.0.1:0", Handler: handler})
+	if err := ws.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := ws.Stop(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	response, err := http.Get(ws.BaseUrl() + "/users/42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if expected, actual := "/users/:id", pattern; actual != expected {
+		t.Errorf("Expected route pattern=%q but actual=%q", expected, actual)
+	}
+}
+
+func TestCorsBundle(t *testing.T) {
+	h, err := route.Activate(
+		[]route.RouteMiddlewareBundle{
+			route.RouteMiddlewareBundle{
+				Cors: &web.CorsOptions{AllowedOrigins: []string{"https://app.example.com"}},
+				RouteData: []route.RouteDatum{
+					{Reciever: "get|put", Path: "/items/:id", HandlerFunc: func(w http.ResponseWriter, req *http.Request) { fmt.Fprint(w, "item") }},
+				},
+			},
+			route.RouteMiddlewareBundle{
+				RouteData: []route.RouteDatum{
+					{Reciever: "get", Path: "/private", HandlerFunc: func(w http.ResponseWriter, req *http.Request) { fmt.Fprint(w, "private") }},
+				},
+			},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws := web.NewWebServer(web.WebServerOptions{Addr: "127.0.0.1:0", Handler: h.Handler()})
+	if err := ws.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := ws.Stop(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	do := func(method string, path string, headers map[string]string) *http.Response {
+		req, err := http.NewRequest(method, ws.BaseUrl()+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		response, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		return response
+	}
+
+	response := do("OPTIONS", "/items/1", map[string]string{"Origin": "https://app.example.com", "Access-Control-Request-Method": "PUT"})
+	if expected, actual := http.StatusNoContent, response.StatusCode; actual != expected {
+		t.Errorf("Expected preflight status-code=%v but actual=%v", expected, actual)
+	}
+	if expected, actual := "GET, HEAD, PUT, OPTIONS", response.Header.Get("Access-Control-Allow-Methods"); actual != expected {
+		t.Errorf("Expected Access-Control-Allow-Methods=%q but actual=%q", expected, actual)
+	}
+
+	response = do("GET", "/items/1", map[string]string{"Origin": "https://app.example.com"})
+	if expected, actual := "https://app.example.com", response.Header.Get("Access-Control-Allow-Origin"); actual != expected {
+		t.Errorf("Expected Access-Control-Allow-Origin=%q but actual=%q", expected, actual)
+	}
+
+	// The policy doesn't leak into other bundles.
+	response = do("GET", "/private", map[string]string{"Origin": "https://app.example.com"})
+	if actual := response.Header.Get("Access-Control-Allow-Origin"); len(actual) > 0 {
+		t.Errorf("Expected no Access-Control-Allow-Origin for a route outside the CORS bundle but actual=%q", actual)
+	}
+}
+
+func TestCorsPreflightSkipsAuthentication(t *testing.T) {
+	seen := 0
+	count := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			seen++
+			next.ServeHTTP(w, req)
+		})
+	}
+	auth := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if len(req.Header.Get("Authorization")) == 0 {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, req)
+		})
+	}
+	ok := func(w http.ResponseWriter, req *http.Request) { fmt.Fprint(w, "ok") }
+	h, err := route.Activate(
+		[]route.RouteMiddlewareBundle{
+			route.RouteMiddlewareBundle{
+				Middlewares: []func(http.Handler) http.Handler{count, web.SkipPreflight(auth)},
+				Cors:        &web.CorsOptions{AllowedOrigins: []string{"https://app.example.com"}},
+				RouteData: []route.RouteDatum{
+					{Reciever: "put", Path: "/items/:id", HandlerFunc: ok},
+				},
+			},
+			route.RouteMiddlewareBundle{
+				Cors: &web.CorsOptions{AllowedOrigins: []string{"https://app.example.com"}},
+				RouteData: []route.RouteDatum{
+					{Reciever: "post", Path: "/widgets", HandlerFunc: ok},
+				},
+			},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The second bundle's preflights mustn't be blocked by the first's
+	// authentication either, but still pass through its other middlewares.
+	for path, method := range map[string]string{"/items/1": "PUT", "/widgets": "POST"} {
+		req := httptest.NewRequest("OPTIONS", path, nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", method)
+		w := httptest.NewRecorder()
+		h.Handler().ServeHTTP(w, req)
+		if expected, actual := http.StatusNoContent, w.Code; actual != expected {
+			t.Errorf("[path=%v] Expected preflight status-code=%v but actual=%v", path, expected, actual)
+		}
+		if expected, actual := "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"); actual != expected {
+			t.Errorf("[path=%v] Expected Access-Control-Allow-Origin=%q but actual=%q", path, expected, actual)
+		}
+	}
+	if expected, actual := 2, seen; actual != expected {
+		t.Errorf("Expected preflights seen by middleware=%v but actual=%v", expected, actual)
+	}
+
+	// Everything else still requires authentication.
+	for _, method := range []string{"PUT", "OPTIONS"} {
+		req := httptest.NewRequest(method, "/items/1", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		w := httptest.NewRecorder()
+		h.Handler().ServeHTTP(w, req)
+		if expected, actual := http.StatusUnauthorized, w.Code; actual != expected {
+			t.Errorf("[method=%v] Expected status-code=%v but actual=%v", method, expected, actual)
+		}
+	}
+}
+
+func TestMethods(t *testing.T) {
+	ok := func(w http.ResponseWriter, req *http.Request) { fmt.Fprint(w, req.Method) }
+	h, err := route.Activate(
+		[]route.RouteMiddlewareBundle{
+			route.RouteMiddlewareBundle{
+				RouteData: []route.RouteDatum{
+					{Reciever: "get|post", Path: "/items", HandlerFunc: ok},
+					{Reciever: "any", Path: "/anything", HandlerFunc: ok},
+				},
+			},
+			route.RouteMiddlewareBundle{
+				RouteData: []route.RouteDatum{
+					{Reciever: "delete", Path: "/items", HandlerFunc: ok},
+					{Reciever: "options", Path: "/custom", HandlerFunc: func(w http.ResponseWriter, req *http.Request) { w.Header().Set("Allow", "custom") }},
+				},
+			},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws := web.NewWebServer(web.WebServerOptions{Addr: "127.0.0.1:0", Handler: h.Handler()})
+	if err := ws.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := ws.Stop(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	testCases := []struct {
+		method     string
+		path       string
+		statusCode int
+		allow      string
+	}{
+		{"GET", "/items", http.StatusOK, ""},
+		{"HEAD", "/items", http.StatusOK, ""},
+		{"DELETE", "/items", http.StatusOK, ""},
+		{"PUT", "/items", http.StatusMethodNotAllowed, "GET, HEAD, POST, DELETE, OPTIONS"},
+		{"OPTIONS", "/items", http.StatusNoContent, "GET, HEAD, POST, DELETE, OPTIONS"},
+		{"PATCH", "/anything", http.StatusOK, ""},
+		{"OPTIONS", "/anything", http.StatusOK, ""},
+		{"OPTIONS", "/custom", http.StatusOK, "custom"},
+		{"GET", "/custom", http.StatusMethodNotAllowed, "OPTIONS"},
+		{"GET", "/missing", http.StatusNotFound, ""},
+	}
+	for i, testCase := range testCases {
+		req, err := http.NewRequest(testCase.method, ws.BaseUrl()+testCase.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if expected, actual := testCase.statusCode, response.StatusCode; actual != expected {
+			t.Errorf("[i=%v] Expected %v %v status-code=%v but actual=%v", i, testCase.method, testCase.path, expected, actual)
+		}
+		if expected, actual := testCase.allow, response.Header.Get("Allow"); actual != expected {
+			t.Errorf("[i=%v] Expected %v %v Allow=%q but actual=%q", i, testCase.method, testCase.path, expected, actual)
+		}
+	}
+}
+
+func TestActivateErrors(t *testing.T) {
+	ok := func(w http.ResponseWriter, req *http.Request) {}
+	testCases := [][]route.RouteDatum{
+		{{Reciever: "get|fetch", Path: "/", HandlerFunc: ok}},
+		{{Reciever: "get", Path: "/", HandlerFunc: ok}, {Reciever: "get", Path: "/", HandlerFunc: ok}},
+	}
+	for i, routeData := range testCases {
+		if _, err := route.Activate([]route.RouteMiddlewareBundle{{RouteData: routeData}}); err == nil {
+			t.Errorf("[i=%v] Expected an error activating routes=%+v", i, routeData)
+		}
+	}
+	if _, err := route.Activate(nil); err == nil {
+		t.Error("Expected an error activating no bundles")
+	}
+}
+
+func TestGroupsAndMounts(t *testing.T) {
+	var (
+		patterns  = []string{}
+		addHeader = func(name string) func(http.Handler) http.Handler {
+			return func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					w.Header().Add("X-Middleware", name)
+					next.ServeHTTP(w, req)
+				})
+			}
+		}
+		echoPath = func(w http.ResponseWriter, req *http.Request) {
+			patterns = append(patterns, web.RoutePattern(req))
+			fmt.Fprint(w, req.URL.Path)
+		}
+	)
+	h, err := route.Activate(
+		[]route.RouteMiddlewareBundle{
+			route.RouteMiddlewareBundle{
+				Prefix:      "/v1",
+				Middlewares: []func(http.Handler) http.Handler{addHeader("bundle")},
+				RouteData: []route.RouteDatum{
+					{Reciever: "get", Path: "/public", HandlerFunc: echoPath},
+					{Reciever: "get", Path: "/audited", HandlerFunc: echoPath, Middlewares: []func(http.Handler) http.Handler{addHeader("route")}},
+				},
+				Groups: []route.RouteMiddlewareBundle{
+					{
+						Prefix:      "/admin",
+						Middlewares: []func(http.Handler) http.Handler{addHeader("admin")},
+						RouteData: []route.RouteDatum{
+							{Reciever: "get", Path: "/users/:id", HandlerFunc: echoPath},
+						},
+						Mounts: []route.Mount{
+							{Prefix: "/files", Handler: http.HandlerFunc(echoPath)},
+						},
+					},
+				},
+			},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracking := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		h.Handler().ServeHTTP(w, web.TrackRoutePattern(req))
+	})
+	ws := web.NewWebServer(web.WebServerOptions{Addr: "127.0.0.1:0", Handler: tracking})
+	if err := ws.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := ws.Stop(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	testCases := []struct {
+		path        string
+		statusCode  int
+		body        string
+		middlewares []string
+	}{
+		{"/v1/public", http.StatusOK, "/v1/public", []string{"bundle"}},
+		{"/v1/audited", http.StatusOK, "/v1/audited", []string{"bundle", "route"}},
+		{"/v1/admin/users/7", http.StatusOK, "/v1/admin/users/7", []string{"bundle", "admin"}},
+		{"/v1/admin/files/a/b.txt", http.StatusOK, "/a/b.txt", []string{"bundle", "admin"}},
+		{"/admin/users/7", http.StatusNotFound, "", []string{"bundle"}},
+	}
+	for i, testCase := range testCases {
+		response, err := http.Get(ws.BaseUrl() + testCase.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := testCase.statusCode, response.StatusCode; actual != expected {
+			t.Errorf("[i=%v] Expected %v status-code=%v but actual=%v", i, testCase.path, expected, actual)
+			continue
+		}
+		if testCase.statusCode == http.StatusOK {
+			if expected, actual := testCase.body, string(body); actual != expected {
+				t.Errorf("[i=%v] Expected %v body=%q but actual=%q", i, testCase.path, expected, actual)
+			}
+		}
+		if expected, actual := fmt.Sprint(testCase.middlewares), fmt.Sprint(response.Header["X-Middleware"]); actual != expected {
+			t.Errorf("[i=%v] Expected %v middlewares=%v but actual=%v", i, testCase.path, expected, actual)
+		}
+	}
+	if expected, actual := "[/v1/public /v1/audited /v1/admin/users/:id /v1/admin/files/*path]", fmt.Sprint(patterns); actual != expected {
+		t.Errorf("Expected route patterns=%v but actual=%v", expected, actual)
+	}
+}
+
+func TestMountRequiresPrefix(t *testing.T) {
+	_, err := route.Activate([]route.RouteMiddlewareBundle{{Mounts: []route.Mount{{Prefix: "/", Handler: http.NotFoundHandler()}}}})
+	if err == nil {
+		t.Error("Expected an error mounting a handler at the root")
+	}
+}
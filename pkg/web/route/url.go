@@ -0,0 +1,120 @@
+package route
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Params are the values for a route's path parameters, keyed by name without
+// the leading ":" or "*".
+type Params map[string]string
+
+// UrlBuilder produces URLs for named routes (see `RouteDatum.Name'), e.g. for
+// pagination links:
+//
+//     urls, err := route.NewUrlBuilder(bundles)
+//     ...
+//     meta.Next, err = urls.Url("user-posts", route.Params{"id": "42"}, url.Values{"offset": {"20"}})
+//     // meta.Next == "/v1/users/42/posts?offset=20"
+type UrlBuilder struct {
+	BaseUrl string            // Optional scheme and host prepended to generated URLs, e.g. "https://api.example.com".
+	paths   map[string]string // Full path templates keyed by route name.
+}
+
+// NewUrlBuilder collects the named routes of the bundles, including those of
+// nested groups.  An error is returned if a name is used more than once.
+func NewUrlBuilder(rmbs []RouteMiddlewareBundle) (*UrlBuilder, error) {
+	builder := &UrlBuilder{
+		paths: map[string]string{},
+	}
+	for _, rmb := range rmbs {
+		if err := builder.collect(rmb, ""); err != nil {
+			return nil, err
+		}
+	}
+	return builder, nil
+}
+
+func (builder *UrlBuilder) collect(rmb RouteMiddlewareBundle, prefix string) error {
+	prefix = joinPath(prefix, rmb.Prefix)
+	for _, routeDatum := range rmb.RouteData {
+		if len(routeDatum.Name) == 0 {
+			continue
+		}
+		path := joinPath(prefix, routeDatum.Path)
+		if existing, ok := builder.paths[routeDatum.Name]; ok {
+			return fmt.Errorf("route: duplicate route name=%q for paths %v and %v", routeDatum.Name, existing, path)
+		}
+		builder.paths[routeDatum.Name] = path
+	}
+	for _, group := range rmb.Groups {
+		if err := builder.collect(group, prefix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Names returns the route names in sorted order.
+func (builder *UrlBuilder) Names() []string {
+	names := make([]string, 0, len(builder.paths))
+	for name := range builder.paths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Path produces the path of the named route with its parameters filled in
+// from params.  Every parameter of the route must be supplied, and params must
+// not contain any others.
+func (builder *UrlBuilder) Path(name string, params Params) (string, error) {
+	template, ok := builder.paths[name]
+	if !ok {
+		return "", fmt.Errorf("route: no route named %q", name)
+	}
+	var (
+		segments = strings.Split(template, "/")
+		used     = 0
+	)
+	for i, segment := range segments {
+		if len(segment) == 0 || (segment[0] != ':' && segment[0] != '*') {
+			continue
+		}
+		value, ok := params[segment[1:]]
+		if !ok || (segment[0] == ':' && len(value) == 0) {
+			return "", fmt.Errorf("route: missing parameter %q for route name=%q path=%v", segment[1:], name, template)
+		}
+		used++
+		if segment[0] == '*' {
+			// NB: Catch-all values span segments, so slashes are preserved.
+			parts := strings.Split(strings.TrimPrefix(value, "/"), "/")
+			for j, part := range parts {
+				parts[j] = url.PathEscape(part)
+			}
+			segments[i] = strings.Join(parts, "/")
+		} else {
+			segments[i] = url.PathEscape(value)
+		}
+	}
+	if used != len(params) {
+		return "", fmt.Errorf("route: unknown parameters supplied for route name=%q path=%v: %v", name, template, params)
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// Url produces the URL of the named route with its parameters filled in from
+// params (see `Path()') and query appended, prefixed by `BaseUrl'.
+func (builder *UrlBuilder) Url(name string, params Params, query url.Values) (string, error) {
+	path, err := builder.Path(name, params)
+	if err != nil {
+		return "", err
+	}
+	u := strings.TrimSuffix(builder.BaseUrl, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u, nil
+}
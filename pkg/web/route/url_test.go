@@ -0,0 +1,100 @@
+package route_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gigawattio/go-commons/pkg/web/route"
+)
+
+func TestUrlBuilder(t *testing.T) {
+	ok := func(w http.ResponseWriter, req *http.Request) {}
+	urls, err := route.NewUrlBuilder(
+		[]route.RouteMiddlewareBundle{
+			route.RouteMiddlewareBundle{
+				Prefix: "/v1",
+				RouteData: []route.RouteDatum{
+					{Name: "users", Reciever: "get", Path: "/users", HandlerFunc: ok},
+					{Reciever: "post", Path: "/users", HandlerFunc: ok},
+				},
+				Groups: []route.RouteMiddlewareBundle{
+					{
+						Prefix: "/users/:id",
+						RouteData: []route.RouteDatum{
+							{Name: "user-posts", Reciever: "get", Path: "/posts", HandlerFunc: ok},
+						},
+					},
+				},
+			},
+			route.RouteMiddlewareBundle{
+				RouteData: []route.RouteDatum{
+					{Name: "files", Reciever: "get", Path: "/files/*filepath", HandlerFunc: ok},
+				},
+			},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	urls.BaseUrl = "https://api.example.com/"
+
+	if expected, actual := "[files user-posts users]", fmt.Sprint(urls.Names()); actual != expected {
+		t.Errorf("Expected names=%v but actual=%v", expected, actual)
+	}
+
+	testCases := []struct {
+		name     string
+		params   route.Params
+		query    url.Values
+		expected string
+	}{
+		{"users", nil, nil, "https://api.example.com/v1/users"},
+		{"users", nil, url.Values{"limit": {"10"}, "offset": {"20"}}, "https://api.example.com/v1/users?limit=10&offset=20"},
+		{"user-posts", route.Params{"id": "a b/c"}, nil, "https://api.example.com/v1/users/a%20b%2Fc/posts"},
+		{"files", route.Params{"filepath": "/css/site main.css"}, nil, "https://api.example.com/files/css/site%20main.css"},
+	}
+	for i, testCase := range testCases {
+		actual, err := urls.Url(testCase.name, testCase.params, testCase.query)
+		if err != nil {
+			t.Errorf("[i=%v] Unexpected error building url for name=%q: %s", i, testCase.name, err)
+			continue
+		}
+		if actual != testCase.expected {
+			t.Errorf("[i=%v] Expected url=%q but actual=%q", i, testCase.expected, actual)
+		}
+	}
+
+	errorCases := []struct {
+		name   string
+		params route.Params
+	}{
+		{"missing", nil},
+		{"user-posts", nil},
+		{"user-posts", route.Params{"id": ""}},
+		{"user-posts", route.Params{"id": "1", "extra": "2"}},
+	}
+	for i, errorCase := range errorCases {
+		if u, err := urls.Url(errorCase.name, errorCase.params, nil); err == nil {
+			t.Errorf("[i=%v] Expected an error building url for name=%q params=%v but got url=%q", i, errorCase.name, errorCase.params, u)
+		}
+	}
+}
+
+func TestUrlBuilderDuplicateName(t *testing.T) {
+	ok := func(w http.ResponseWriter, req *http.Request) {}
+	_, err := route.NewUrlBuilder(
+		[]route.RouteMiddlewareBundle{
+			route.RouteMiddlewareBundle{
+				RouteData: []route.RouteDatum{
+					{Name: "a", Reciever: "get", Path: "/a", HandlerFunc: ok},
+					{Name: "a", Reciever: "get", Path: "/b", HandlerFunc: ok},
+				},
+			},
+		},
+	)
+	if err == nil {
+		t.Error("Expected an error for a duplicate route name")
+	}
+}
@@ -0,0 +1,48 @@
+package web
+
+import (
+	"context"
+	"net/http"
+)
+
+// Middleware wraps the router, so the matched route is only known after the
+// request has been dispatched.  TrackRoutePattern places a holder in the
+// request context which `WithRoutePattern' (applied to every route by
+// `route.Activate') fills in, and the middleware reads back once `next'
+// returns.
+
+type routePatternKey struct{}
+
+type routePattern struct {
+	pattern string
+}
+
+// TrackRoutePattern returns req with a route pattern holder attached, unless
+// one is already present.
+func TrackRoutePattern(req *http.Request) *http.Request {
+	if _, ok := req.Context().Value(routePatternKey{}).(*routePattern); ok {
+		return req
+	}
+	return req.WithContext(context.WithValue(req.Context(), routePatternKey{}, &routePattern{}))
+}
+
+// RoutePattern returns the path template of the route which handled req, e.g.
+// "/users/:id", or the empty string when no route matched or req wasn't passed
+// through `TrackRoutePattern()'.
+func RoutePattern(req *http.Request) string {
+	if holder, ok := req.Context().Value(routePatternKey{}).(*routePattern); ok {
+		return holder.pattern
+	}
+	return ""
+}
+
+// WithRoutePattern produces a handler which records pattern as the route
+// pattern of the request before invoking next.
+func WithRoutePattern(pattern string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if holder, ok := req.Context().Value(routePatternKey{}).(*routePattern); ok {
+			holder.pattern = pattern
+		}
+		next.ServeHTTP(w, req)
+	})
+}
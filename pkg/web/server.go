@@ -1,36 +1,67 @@
 package web
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	golog "log"
 	"net"
 	"net/http"
+	"os"
 	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/gigawattio/go-commons/pkg/errorlib"
-	"github.com/jaytaylor/stoppableListener"
 )
 
 const MaxStopChecks = 10
 
 type WebServerOptions struct {
-	Addr           string        // TCP address to listen on, ":http" if empty.
-	Handler        http.Handler  // handler to invoke, http.DefaultServeMux if nil.
-	ReadTimeout    time.Duration // maximum duration before timing out read of the request.
-	WriteTimeout   time.Duration // maximum duration before timing out write of the response.
-	MaxHeaderBytes int           // maximum size of request headers, net/http.DefaultMaxHeaderBytes if 0.
-	TLSConfig      *tls.Config   // optional TLS config, used by ListenAndServeTLS.
-	ErrorLog       *golog.Logger
+	Addr            string        // TCP address (or "unix:" prefixed socket path) to listen on, ":http" if empty.
+	Handler         http.Handler  // handler to invoke, http.DefaultServeMux if nil.
+	ReadTimeout     time.Duration // maximum duration before timing out read of the request.
+	WriteTimeout    time.Duration // maximum duration before timing out write of the response.
+	MaxHeaderBytes  int           // maximum size of request headers, net/http.DefaultMaxHeaderBytes if 0.
+	TLSConfig       *tls.Config   // optional TLS config, HTTPS is served when it provides certificates.
+	ErrorLog        *golog.Logger
+	ShutdownTimeout time.Duration // maximum duration `Stop()' waits for in-flight requests, DefaultShutdownTimeout if 0.
+
+	CertFile           string             // PEM certificate file, HTTPS is served when set along with KeyFile.
+	KeyFile            string             // PEM private key file.
+	CertReloadInterval time.Duration      // how often CertFile and KeyFile are checked for changes, DefaultCertReloadInterval if 0.
+	ClientCAFile       string             // PEM CA bundle, when set client certificates are verified against it (mutual TLS).
+	ClientAuth         tls.ClientAuthType // client certificate policy when ClientCAFile is set, tls.RequireAndVerifyClientCert if 0.
+	RedirectAddr       string             // optional TCP address for a plain HTTP listener which redirects to HTTPS.
+
+	HTTP2                bool   // serve HTTP/2 over TLS, negotiated via ALPN.
+	H2C                  bool   // serve cleartext HTTP/2 (h2c) via prior knowledge or `Upgrade: h2c'.
+	MaxConcurrentStreams uint32 // maximum concurrent HTTP/2 streams per connection, 250 if 0.
+
+	Addrs            []string    // additional addresses to listen on, in the same form as Addr.
+	SocketMode       os.FileMode // permissions for Unix sockets, DefaultSocketMode if 0.
+	SocketUser       string      // optional owner for Unix sockets.
+	SocketGroup      string      // optional group for Unix sockets.
+	SocketActivation bool        // serve listeners passed via systemd socket activation (LISTEN_FDS), Addr is then only bound when non-empty.
+
+	Health            *Health       // optional, serves the liveness and readiness endpoints ahead of Handler.
+	HealthGracePeriod time.Duration // how long readiness reports failing during `Shutdown()' before the listeners are closed, `Stop()' adds it to ShutdownTimeout.
 }
 
 type WebServer struct {
-	Options  WebServerOptions
-	server   *http.Server
-	listener *stoppableListener.StoppableListener
-	lock     sync.RWMutex
+	Options          WebServerOptions
+	server           *http.Server
+	listeners        []net.Listener // NB: Without the TLS wrapping.
+	done             chan struct{}  // Closed once `Serve' returns for all listeners.
+	redirectServer   *http.Server
+	redirectListener net.Listener
+	redirectDone     chan struct{}
+	certReloader     *CertReloader
+	tls              bool
+	stopping         bool
+	shutdownHooks    []ShutdownHook
+	lock             sync.RWMutex
 }
 
 type StaticHttpHandler struct {
@@ -61,66 +92,302 @@ func (ws *WebServer) Start() error {
 	ws.lock.Lock()
 	defer ws.lock.Unlock()
 
-	if ws.server != nil || ws.listener != nil {
+	if ws.server != nil || ws.listeners != nil {
 		return errorlib.AlreadyRunningError
 	}
-	rawListener, err := net.Listen("tcp", ws.Options.Addr)
+	tlsConfig, certReloader, err := ws.tlsConfig()
 	if err != nil {
 		return err
 	}
-	listener, err := stoppableListener.New(rawListener)
-	if err != nil {
-		return err
+	if tlsConfig == nil && len(ws.Options.RedirectAddr) > 0 {
+		return errors.New("web.WebServer: RedirectAddr requires TLS to be configured")
 	}
-	ws.listener = listener
-	ws.server = &http.Server{
-		Handler:        ws.Options.Handler,
+	handler := ws.Options.Handler
+	if ws.Options.Health != nil {
+		if handler == nil {
+			handler = http.DefaultServeMux
+		}
+		handler = ws.Options.Health.Middleware(handler)
+		ws.Options.Health.SetShuttingDown(false)
+	}
+	server := &http.Server{
+		Handler:        handler,
 		ReadTimeout:    ws.Options.ReadTimeout,
 		WriteTimeout:   ws.Options.WriteTimeout,
 		MaxHeaderBytes: ws.Options.MaxHeaderBytes,
-		TLSConfig:      ws.Options.TLSConfig,
+		TLSConfig:      tlsConfig,
 		ErrorLog:       ws.Options.ErrorLog,
 	}
-	go func() {
-		if err := ws.server.Serve(ws.listener); err != nil && err != stoppableListener.StoppedError {
-			log.Infof("web.WebServer: error on ws with Options=%+v: %s", ws.Options, err)
+	if err = ws.configureHTTP2(server, tlsConfig != nil); err != nil {
+		return err
+	}
+
+	// Listeners handed down by a hot restart take the place of binding new ones.
+	listeners, redirectListener, err := hotRestartListeners()
+	if err != nil {
+		return err
+	}
+	if len(listeners) == 0 {
+		if listeners, err = ws.openListeners(); err != nil {
+			return err
 		}
-		// log.Info("Server done!")
-	}()
+	}
+	if redirectListener == nil && len(ws.Options.RedirectAddr) > 0 {
+		if redirectListener, err = net.Listen("tcp", ws.Options.RedirectAddr); err != nil {
+			closeListeners(listeners)
+			return err
+		}
+	}
+	if certReloader != nil {
+		if err = certReloader.Start(); err != nil {
+			closeListeners(listeners)
+			if redirectListener != nil {
+				redirectListener.Close()
+			}
+			return err
+		}
+	}
+
+	ws.server = server
+	ws.tls = tlsConfig != nil
+	served := listeners
+	if ws.tls {
+		served = make([]net.Listener, len(listeners))
+		for i, listener := range listeners {
+			served[i] = tls.NewListener(listener, server.TLSConfig)
+		}
+	}
+	ws.listeners = listeners
+	ws.certReloader = certReloader
+	ws.done = ws.serve(ws.server, served...)
+
+	if redirectListener != nil {
+		var httpsPort string
+		for _, listener := range listeners {
+			if _, port, err := net.SplitHostPort(listener.Addr().String()); err == nil {
+				httpsPort = port
+				break
+			}
+		}
+		ws.redirectServer = &http.Server{
+			Handler:        HttpsRedirectHandler(httpsPort),
+			ReadTimeout:    ws.Options.ReadTimeout,
+			WriteTimeout:   ws.Options.WriteTimeout,
+			MaxHeaderBytes: ws.Options.MaxHeaderBytes,
+			ErrorLog:       ws.Options.ErrorLog,
+		}
+		ws.redirectListener = redirectListener
+		ws.redirectDone = ws.serve(ws.redirectServer, ws.redirectListener)
+	}
 	return nil
 }
 
-// Stop terminates the WebServer.
+// serve runs server on each listener in a new goroutine and returns a channel
+// which is closed once `Serve' has returned for all of them.
+func (ws *WebServer) serve(server *http.Server, listeners ...net.Listener) chan struct{} {
+	var (
+		done = make(chan struct{})
+		wg   sync.WaitGroup
+	)
+	for _, listener := range listeners {
+		wg.Add(1)
+		go func(listener net.Listener) {
+			defer wg.Done()
+			if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+				log.Infof("web.WebServer: error on ws with Options=%+v: %s", ws.Options, err)
+			}
+			// log.Info("Server done!")
+		}(listener)
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return done
+}
+
+// tlsConfig produces the TLS configuration for the server according to the
+// options, or nil when TLS is not configured.
+func (ws *WebServer) tlsConfig() (*tls.Config, *CertReloader, error) {
+	var (
+		config       *tls.Config
+		certReloader *CertReloader
+		err          error
+	)
+	if ws.Options.TLSConfig != nil {
+		config = ws.Options.TLSConfig.Clone()
+	}
+	if len(ws.Options.CertFile) > 0 || len(ws.Options.KeyFile) > 0 {
+		if certReloader, err = NewCertReloader(ws.Options.CertFile, ws.Options.KeyFile); err != nil {
+			return nil, nil, err
+		}
+		certReloader.Interval = ws.Options.CertReloadInterval
+		if config == nil {
+			config = &tls.Config{}
+		}
+		config.GetCertificate = certReloader.GetCertificate
+	}
+	if config == nil || (len(config.Certificates) == 0 && config.GetCertificate == nil) {
+		if len(ws.Options.ClientCAFile) > 0 {
+			return nil, nil, errors.New("web.WebServer: ClientCAFile requires a server certificate to be configured")
+		}
+		return nil, nil, nil
+	}
+	if len(ws.Options.ClientCAFile) > 0 {
+		if config.ClientCAs, err = LoadCertPool(ws.Options.ClientCAFile); err != nil {
+			return nil, nil, fmt.Errorf("web.WebServer: loading ClientCAFile=%v: %s", ws.Options.ClientCAFile, err)
+		}
+		config.ClientAuth = ws.Options.ClientAuth
+		if config.ClientAuth == tls.NoClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return config, certReloader, nil
+}
+
+// Stop gracefully terminates the WebServer, waiting up to
+// `Options.ShutdownTimeout' for in-flight requests to complete.  The timeout
+// starts once `Options.HealthGracePeriod' (if any) has elapsed.
 func (ws *WebServer) Stop() error {
-	ws.lock.Lock()
-	defer ws.lock.Unlock()
+	timeout := shutdownTimeout(ws.Options.ShutdownTimeout)
+	if ws.Options.Health != nil {
+		timeout += ws.Options.HealthGracePeriod
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return ws.Shutdown(ctx)
+}
 
-	if ws.server == nil || ws.listener == nil {
+// Shutdown gracefully terminates the WebServer.  When `Options.Health' is set,
+// readiness flips to failing and the listeners are kept open for
+// `Options.HealthGracePeriod' so load-balancers stop routing traffic here.
+// Then the listeners are closed, and in-flight requests are given until ctx is
+// done to complete before their connections are forcibly closed.  Finally, the
+// shutdown hooks are run.  NB: ctx bounds the grace period too, so its deadline
+// must leave time for draining.
+//
+// A non-nil error is returned when requests had to be forcibly terminated or a
+// hook failed, but the WebServer is stopped either way.
+func (ws *WebServer) Shutdown(ctx context.Context) error {
+	ws.lock.Lock()
+	if ws.server == nil || ws.listeners == nil || ws.stopping {
+		ws.lock.Unlock()
 		return errorlib.NotRunningError
 	}
-	if err := ws.listener.StopSafely(); err != nil {
-		return err
+	ws.stopping = true
+	var (
+		server         = ws.server
+		done           = ws.done
+		redirectServer = ws.redirectServer
+		redirectDone   = ws.redirectDone
+		certReloader   = ws.certReloader
+		hooks          = append([]ShutdownHook{}, ws.shutdownHooks...)
+	)
+	ws.lock.Unlock()
+
+	if health := ws.Options.Health; health != nil {
+		health.SetShuttingDown(true)
+		if ws.Options.HealthGracePeriod > 0 {
+			select {
+			case <-time.After(ws.Options.HealthGracePeriod):
+			case <-ctx.Done():
+			}
+		}
+	}
+
+	// NB: The lock isn't held while draining so handlers may still invoke
+	// methods such as `Addr()'.
+	errs := []error{}
+	if redirectServer != nil {
+		errs = append(errs, drain(ctx, redirectServer, redirectDone))
 	}
+	errs = append(errs, drain(ctx, server, done))
+	if certReloader != nil {
+		errs = append(errs, certReloader.Stop())
+	}
+	errs = append(errs, runShutdownHooks(ctx, hooks))
+
+	ws.lock.Lock()
 	ws.server = nil
-	ws.listener = nil
-	return nil
+	ws.listeners = nil
+	ws.redirectServer = nil
+	ws.redirectListener = nil
+	ws.certReloader = nil
+	ws.stopping = false
+	ws.lock.Unlock()
+
+	return errorlib.Merge(errs)
 }
 
-// Addr exposes the listener address.
+// OnShutdown registers a hook to be run during `Shutdown()', after in-flight
+// requests have been drained.  Hooks are run in the order registered.
+func (ws *WebServer) OnShutdown(hook ShutdownHook) {
+	ws.lock.Lock()
+	ws.shutdownHooks = append(ws.shutdownHooks, hook)
+	ws.lock.Unlock()
+}
+
+// Addr exposes the listener address.  When there are multiple listeners the
+// address of the first one is returned.
 func (ws *WebServer) Addr() net.Addr {
 	ws.lock.RLock()
 	defer ws.lock.RUnlock()
 
-	if ws.listener == nil {
+	if len(ws.listeners) == 0 {
+		return &net.IPAddr{}
+	}
+	addr := ws.listeners[0].Addr()
+	return addr
+}
+
+// Addrs exposes the addresses of all listeners.
+func (ws *WebServer) Addrs() []net.Addr {
+	ws.lock.RLock()
+	defer ws.lock.RUnlock()
+
+	addrs := make([]net.Addr, len(ws.listeners))
+	for i, listener := range ws.listeners {
+		addrs[i] = listener.Addr()
+	}
+	return addrs
+}
+
+// RedirectAddr exposes the HTTP->HTTPS redirect listener address.
+func (ws *WebServer) RedirectAddr() net.Addr {
+	ws.lock.RLock()
+	defer ws.lock.RUnlock()
+
+	if ws.redirectListener == nil {
 		return &net.IPAddr{}
 	}
-	addr := ws.listener.Addr()
+	addr := ws.redirectListener.Addr()
 	return addr
 }
 
+// ReloadCertificates immediately reloads the certificate and key from
+// `Options.CertFile' and `Options.KeyFile'.  Certificates are otherwise
+// reloaded automatically upon change or SIGHUP.
+func (ws *WebServer) ReloadCertificates() error {
+	ws.lock.RLock()
+	certReloader := ws.certReloader
+	ws.lock.RUnlock()
+
+	if certReloader == nil {
+		return errorlib.NotRunningError
+	}
+	return certReloader.Reload()
+}
+
 // BaseUrl provides a working URL base path to the web server instance.
 func (ws *WebServer) BaseUrl() string {
-	url := fmt.Sprintf("http://%s", ws.Addr())
+	ws.lock.RLock()
+	scheme := "http"
+	if ws.tls {
+		scheme = "https"
+	}
+	ws.lock.RUnlock()
+
+	url := fmt.Sprintf("%s://%s", scheme, ws.Addr())
 	return url
 }
 
@@ -1,12 +1,14 @@
 package web
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os/exec"
 	"strings"
 	"testing"
+	"time"
 )
 
 const testAddr = "127.0.0.1:0"
@@ -99,3 +101,97 @@ func TestBaseUrl(t *testing.T) {
 		t.Errorf(`Expected BaseUrl="%s" but instead found "%s"`, expected, actual)
 	}
 }
+
+func TestShutdownDrainsInFlightRequests(t *testing.T) {
+	var (
+		started  = make(chan struct{})
+		release  = make(chan struct{})
+		hookRuns = 0
+	)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("finished"))
+	})
+	server := NewWebServer(WebServerOptions{Addr: testAddr, Handler: handler})
+	server.OnShutdown(func(_ context.Context) error {
+		hookRuns++
+		return nil
+	})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		body string
+		err  error
+	}
+	results := make(chan result, 1)
+	go func() {
+		response, err := http.Get(server.BaseUrl())
+		if err != nil {
+			results <- result{err: err}
+			return
+		}
+		defer response.Body.Close()
+		body, err := ioutil.ReadAll(response.Body)
+		results <- result{body: string(body), err: err}
+	}()
+	<-started
+
+	shutdownErrs := make(chan error, 1)
+	go func() {
+		shutdownErrs <- server.Shutdown(context.Background())
+	}()
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case err := <-shutdownErrs:
+		t.Fatalf("Shutdown returned before in-flight request completed, err=%v", err)
+	default:
+	}
+	close(release)
+
+	if err := <-shutdownErrs; err != nil {
+		t.Fatal(err)
+	}
+	if r := <-results; r.err != nil || r.body != "finished" {
+		t.Errorf("Expected in-flight request to complete with body=%q but body=%q err=%v", "finished", r.body, r.err)
+	}
+	if expected, actual := 1, hookRuns; actual != expected {
+		t.Errorf("Expected shutdown hook to run %v time(s) but actual=%v", expected, actual)
+	}
+	if err := server.Stop(); err == nil {
+		t.Error("Expected error stopping an already stopped server")
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		close(started)
+		<-release
+	})
+	server := NewWebServer(WebServerOptions{Addr: testAddr, Handler: handler, ShutdownTimeout: 100 * time.Millisecond})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	go http.Get(server.BaseUrl())
+	<-started
+
+	start := time.Now()
+	if err := server.Stop(); err == nil {
+		t.Error("Expected an error when in-flight requests are forcibly terminated")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected Stop to give up after the shutdown timeout but it took %s", elapsed)
+	}
+	// The server must be restartable afterwards.
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Stop(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,56 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gigawattio/go-commons/pkg/errorlib"
+)
+
+// DefaultShutdownTimeout is how long `Stop()' waits for in-flight requests to
+// complete before forcibly closing their connections.
+var DefaultShutdownTimeout = 15 * time.Second
+
+// ShutdownHook is invoked during graceful shutdown once the server has stopped
+// accepting connections and in-flight requests have been drained (or forcibly
+// terminated).  Use hooks to drain background work; they should return promptly
+// once ctx is done.
+type ShutdownHook func(ctx context.Context) error
+
+// drain gracefully shuts down server and waits for its `Serve' goroutine to
+// signal done.  When ctx expires before all in-flight requests complete, the
+// remaining connections are forcibly closed and ctx's error is returned.
+func drain(ctx context.Context, server *http.Server, done <-chan struct{}) error {
+	err := server.Shutdown(ctx)
+	if err != nil {
+		log.Warnf("web: graceful shutdown did not complete, forcibly closing remaining connections: %s", err)
+		if closeErr := server.Close(); closeErr != nil {
+			err = errorlib.Merge([]error{err, closeErr})
+		}
+	}
+	<-done
+	return err
+}
+
+// runShutdownHooks invokes each hook in order, collecting any errors.
+func runShutdownHooks(ctx context.Context, hooks []ShutdownHook) error {
+	errs := []error{}
+	for i, hook := range hooks {
+		if err := hook(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("shutdown hook #%v: %s", i, err))
+		}
+	}
+	return errorlib.Merge(errs)
+}
+
+// shutdownTimeout returns timeout when positive and DefaultShutdownTimeout
+// otherwise.
+func shutdownTimeout(timeout time.Duration) time.Duration {
+	if timeout > 0 {
+		return timeout
+	}
+	return DefaultShutdownTimeout
+}
@@ -0,0 +1,194 @@
+package web
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gigawattio/go-commons/pkg/errorlib"
+)
+
+// DefaultCertReloadInterval is how often certificate files are checked for
+// changes when `WebServerOptions.CertReloadInterval' is 0.
+var DefaultCertReloadInterval = 1 * time.Minute
+
+var NoClientCAsError = errors.New("no certificates found in client CA file")
+
+// CertReloader serves a certificate/key pair loaded from disk, transparently
+// reloading it when the files change or the process receives SIGHUP.
+//
+// Use `GetCertificate' as the `tls.Config.GetCertificate' callback.
+type CertReloader struct {
+	CertFile string
+	KeyFile  string
+	Interval time.Duration // How often to check the files for changes, DefaultCertReloadInterval if 0.
+	cert     *tls.Certificate
+	stamp    string // Modification times and sizes of the loaded files.
+	stopChan chan chan struct{}
+	lock     sync.RWMutex
+}
+
+// NewCertReloader creates a CertReloader and performs the initial load.
+func NewCertReloader(certFile string, keyFile string) (*CertReloader, error) {
+	cr := &CertReloader{
+		CertFile: certFile,
+		KeyFile:  keyFile,
+	}
+	if err := cr.Reload(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// Reload unconditionally loads the certificate/key pair.  Upon error the
+// previously loaded certificate remains in use.
+func (cr *CertReloader) Reload() error {
+	stamp, err := cr.fileStamp()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(cr.CertFile, cr.KeyFile)
+	if err != nil {
+		return fmt.Errorf("loading certificate=%v key=%v: %s", cr.CertFile, cr.KeyFile, err)
+	}
+	cr.lock.Lock()
+	cr.cert = &cert
+	cr.stamp = stamp
+	cr.lock.Unlock()
+	return nil
+}
+
+// GetCertificate returns the currently loaded certificate.
+func (cr *CertReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.lock.RLock()
+	defer cr.lock.RUnlock()
+
+	return cr.cert, nil
+}
+
+// Start begins watching for file changes and SIGHUP.
+func (cr *CertReloader) Start() error {
+	cr.lock.Lock()
+	defer cr.lock.Unlock()
+
+	if cr.stopChan != nil {
+		return errorlib.AlreadyRunningError
+	}
+	cr.stopChan = make(chan chan struct{})
+	go cr.watch(cr.stopChan)
+	return nil
+}
+
+// Stop ends watching.
+func (cr *CertReloader) Stop() error {
+	cr.lock.Lock()
+	if cr.stopChan == nil {
+		cr.lock.Unlock()
+		return errorlib.NotRunningError
+	}
+	stopChan := cr.stopChan
+	cr.stopChan = nil
+	cr.lock.Unlock()
+
+	ack := make(chan struct{})
+	stopChan <- ack
+	<-ack
+	return nil
+}
+
+func (cr *CertReloader) watch(stopChan chan chan struct{}) {
+	interval := cr.Interval
+	if interval <= 0 {
+		interval = DefaultCertReloadInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ticker.C:
+			stamp, err := cr.fileStamp()
+			if err != nil {
+				log.Errorf("web.CertReloader: checking certificate files: %s", err)
+				continue
+			}
+			cr.lock.RLock()
+			changed := stamp != cr.stamp
+			cr.lock.RUnlock()
+			if !changed {
+				continue
+			}
+			log.Infof("web.CertReloader: change detected, reloading certificate=%v", cr.CertFile)
+			if err := cr.Reload(); err != nil {
+				log.Errorf("web.CertReloader: %s", err)
+			}
+
+		case <-hup:
+			log.Infof("web.CertReloader: SIGHUP received, reloading certificate=%v", cr.CertFile)
+			if err := cr.Reload(); err != nil {
+				log.Errorf("web.CertReloader: %s", err)
+			}
+
+		case ack := <-stopChan:
+			ack <- struct{}{}
+			return
+		}
+	}
+}
+
+func (cr *CertReloader) fileStamp() (string, error) {
+	stamp := ""
+	for _, name := range []string{cr.CertFile, cr.KeyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return "", err
+		}
+		stamp += fmt.Sprintf("%v:%v;", info.ModTime().UnixNano(), info.Size())
+	}
+	return stamp, nil
+}
+
+// LoadCertPool reads PEM-encoded certificates from a file into a new pool.
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, NoClientCAsError
+	}
+	return pool, nil
+}
+
+// HttpsRedirectHandler redirects all requests to the same host and path over
+// HTTPS.  When httpsPort is non-empty and not "443" it replaces the port of the
+// request host.
+func HttpsRedirectHandler(httpsPort string) http.Handler {
+	handlerFn := func(w http.ResponseWriter, req *http.Request) {
+		host := req.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if len(httpsPort) > 0 && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+		target := "https://" + host + req.URL.RequestURI()
+		http.Redirect(w, req, target, http.StatusMovedPermanently)
+	}
+	return http.HandlerFunc(handlerFn)
+}
@@ -0,0 +1,231 @@
+package web
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// genTestCert creates a certificate for 127.0.0.1 signed by parent, or
+// self-signed CA certificate when parent is nil.
+func genTestCert(t *testing.T, serial int64, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-1 * time.Hour),
+		NotAfter:     time.Now().Add(1 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	var (
+		signerCert = template
+		signerKey  = key
+	)
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signerCert, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+	}
+	return tc
+}
+
+func (tc *testCert) write(t *testing.T, dir string, name string) (certFile string, keyFile string) {
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	if err := ioutil.WriteFile(certFile, tc.certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, tc.keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func (tc *testCert) tlsCertificate(t *testing.T) tls.Certificate {
+	cert, err := tls.X509KeyPair(tc.certPEM, tc.keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func tlsTestClient(ca *testCert, certificates ...tls.Certificate) *http.Client {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs:      pool,
+				Certificates: certificates,
+			},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return client
+}
+
+func TestWebServerTLSWithReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "web-tls-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := genTestCert(t, 1, nil)
+	certFile, keyFile := genTestCert(t, 2, ca).write(t, dir, "server")
+
+	server := NewStaticWebServer(WebServerOptions{Addr: testAddr, CertFile: certFile, KeyFile: keyFile}, []byte("secure"), http.StatusOK, nil)
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := server.Stop(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	if !strings.HasPrefix(server.BaseUrl(), "https://") {
+		t.Fatalf("Expected BaseUrl to use https but BaseUrl=%v", server.BaseUrl())
+	}
+
+	client := tlsTestClient(ca)
+	servedSerial := func() int64 {
+		response, err := client.Get(server.BaseUrl())
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		return response.TLS.PeerCertificates[0].SerialNumber.Int64()
+	}
+	if expected, actual := int64(2), servedSerial(); actual != expected {
+		t.Fatalf("Expected served certificate serial=%v but actual=%v", expected, actual)
+	}
+
+	genTestCert(t, 3, ca).write(t, dir, "server")
+	if err := server.ReloadCertificates(); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := int64(3), servedSerial(); actual != expected {
+		t.Errorf("Expected served certificate serial=%v after reload but actual=%v", expected, actual)
+	}
+
+	// Plain HTTP must not be served.
+	if response, err := http.Get(strings.Replace(server.BaseUrl(), "https://", "http://", 1)); err == nil {
+		response.Body.Close()
+		if response.StatusCode == http.StatusOK {
+			t.Error("Expected plain HTTP request to an HTTPS server to fail")
+		}
+	}
+}
+
+func TestWebServerMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "web-mtls-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := genTestCert(t, 1, nil)
+	certFile, keyFile := genTestCert(t, 2, ca).write(t, dir, "server")
+	caFile, _ := ca.write(t, dir, "ca")
+
+	server := NewStaticWebServer(WebServerOptions{Addr: testAddr, CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile}, []byte("secure"), http.StatusOK, nil)
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := server.Stop(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	if _, err := tlsTestClient(ca).Get(server.BaseUrl()); err == nil {
+		t.Error("Expected request without a client certificate to be rejected")
+	}
+	clientCert := genTestCert(t, 4, ca).tlsCertificate(t)
+	response, err := tlsTestClient(ca, clientCert).Get(server.BaseUrl())
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if expected, actual := http.StatusOK, response.StatusCode; actual != expected {
+		t.Errorf("Expected status-code=%v but actual=%v", expected, actual)
+	}
+}
+
+func TestWebServerHttpsRedirect(t *testing.T) {
+	ca := genTestCert(t, 1, nil)
+	options := WebServerOptions{
+		Addr:         testAddr,
+		RedirectAddr: testAddr,
+		TLSConfig:    &tls.Config{Certificates: []tls.Certificate{genTestCert(t, 2, ca).tlsCertificate(t)}},
+	}
+	server := NewStaticWebServer(options, []byte("secure"), http.StatusOK, nil)
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := server.Stop(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	response, err := tlsTestClient(ca).Get("http://" + server.RedirectAddr().String() + "/a/b?c=d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if expected, actual := http.StatusMovedPermanently, response.StatusCode; actual != expected {
+		t.Errorf("Expected status-code=%v but actual=%v", expected, actual)
+	}
+	if expected, actual := server.BaseUrl()+"/a/b?c=d", response.Header.Get("Location"); actual != expected {
+		t.Errorf("Expected redirect location=%v but actual=%v", expected, actual)
+	}
+}